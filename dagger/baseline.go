@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"dagger/devsecops/findings"
+	"dagger/devsecops/internal/dagger"
+	"fmt"
+	"path"
+	"slices"
+)
+
+// baselineFindings holds the findings of baseline reports by report path
+// (e.g. "frontend/semgrep.json"). A nil value disables baseline comparison.
+type baselineFindings map[string][]findings.Finding
+
+// loadBaseline parses every report of a baseline reports directory. Reports
+// in an unknown format are skipped.
+func loadBaseline(ctx context.Context, reports *dagger.Directory) (baselineFindings, error) {
+	paths, err := reports.Glob(ctx, "**/*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list baseline reports: %w", err)
+	}
+	slices.Sort(paths)
+
+	baseline := baselineFindings{}
+	for _, p := range paths {
+		contents, err := reports.File(p).Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read baseline report %s: %w", p, err)
+		}
+		parsed, format, err := findings.Parse(p, []byte(contents))
+		if err != nil {
+			return nil, fmt.Errorf("baseline: %w", err)
+		}
+		if format == findings.FormatUnknown {
+			continue
+		}
+		baseline[p] = parsed
+	}
+
+	total := 0
+	for _, parsed := range baseline {
+		total += len(parsed)
+	}
+	fmt.Printf("📐 Baseline: %d finding(s) in %d report(s)\n", total, len(baseline))
+	return baseline, nil
+}
+
+// reportOnlyPolicy never fails a scan; baseline scans only produce reports
+var reportOnlyPolicy = &findings.Policy{
+	Mode:        findings.PolicyPermissive,
+	MinSeverity: findings.SeverityInfo,
+	Overrides:   map[string]*findings.Severity{},
+}
+
+// scanBaseline returns the baseline of a single-scan function: the given
+// baseline reports, or the reports of the same scans run on the baseline
+// source. It returns nil when neither is given.
+func scanBaseline(
+	ctx context.Context,
+	reports *dagger.Directory,
+	source *dagger.Directory,
+	specs func(source *dagger.Directory) ([]*scanSpec, error),
+) (baselineFindings, error) {
+	if reports != nil {
+		return loadBaseline(ctx, reports)
+	}
+	if source == nil {
+		return nil, nil
+	}
+
+	fmt.Println("📐 Scanning baseline source...")
+	baselineSpecs, err := specs(source)
+	if err != nil {
+		return nil, fmt.Errorf("baseline: %w", err)
+	}
+
+	reports = dag.Directory()
+	for _, spec := range baselineSpecs {
+		result, _ := spec.run(ctx, reportOnlyPolicy)
+		if result.Status == "error" || result.Status == "skipped" {
+			continue
+		}
+		reports = reports.WithFile(result.ReportPath, result.Report)
+	}
+	return loadBaseline(ctx, reports)
+}
+
+// scanProjectsBaseline runs the scans of a Test run on the baseline source and
+// returns its findings. Subprojects missing from the baseline source (e.g.
+// added by the change under test) have an empty baseline.
+func (m *Devsecops) scanProjectsBaseline(
+	ctx context.Context,
+	source *dagger.Directory,
+	paths []string,
+	opts scanOptions,
+	maxParallel int,
+) (baselineFindings, error) {
+	fmt.Println("📐 Scanning baseline source...")
+
+	var existing []string
+	for _, p := range paths {
+		if p != "." {
+			if _, err := source.Directory(p).Entries(ctx); err != nil {
+				fmt.Printf("📐 [%s] not in the baseline source, all its findings are new\n", p)
+				continue
+			}
+		}
+		existing = append(existing, p)
+	}
+	if len(existing) == 0 {
+		return baselineFindings{}, nil
+	}
+
+	opts.baseline = nil
+	runs, err := m.scanProjects(ctx, source, existing, opts, reportOnlyPolicy, maxParallel)
+	if err != nil {
+		return nil, fmt.Errorf("baseline: %w", err)
+	}
+
+	reports := dag.Directory()
+	for _, run := range runs {
+		reports = reports.WithDirectory(run.Path, run.Reports)
+	}
+	return loadBaseline(ctx, reports)
+}
+
+// useBaseline enables baseline comparison of a scan of the given project path
+func (s *scanSpec) useBaseline(baseline baselineFindings, projectPath string) {
+	if baseline == nil {
+		return
+	}
+	s.compare = true
+	s.baseline = baseline[path.Join(projectPath, s.report)]
+}
+
+// compareBaseline records the added, fixed and unchanged findings of a scan
+// and returns the added ones, the only findings the policy applies to
+func (r *ScanResult) compareBaseline(current, baseline []findings.Finding) []findings.Finding {
+	known := map[string]bool{}
+	for _, f := range baseline {
+		known[f.Fingerprint] = true
+	}
+
+	seen := map[string]bool{}
+	var added []findings.Finding
+	for _, f := range current {
+		seen[f.Fingerprint] = true
+		if known[f.Fingerprint] {
+			r.Unchanged++
+			continue
+		}
+		added = append(added, f)
+		r.Added = append(r.Added, f.String())
+	}
+
+	for _, f := range baseline {
+		if seen[f.Fingerprint] {
+			continue
+		}
+		seen[f.Fingerprint] = true
+		r.Fixed = append(r.Fixed, f.String())
+	}
+
+	return added
+}
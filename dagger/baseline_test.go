@@ -0,0 +1,129 @@
+package main
+
+import (
+	"dagger/devsecops/findings"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompareBaseline(t *testing.T) {
+	finding := func(rule, fingerprint string) findings.Finding {
+		return findings.Finding{RuleID: rule, Severity: findings.SeverityHigh, Fingerprint: fingerprint}
+	}
+
+	tests := []struct {
+		name          string
+		current       []findings.Finding
+		baseline      []findings.Finding
+		wantAdded     []string
+		wantFixed     []string
+		wantUnchanged int
+	}{
+		{
+			name:      "empty baseline",
+			current:   []findings.Finding{finding("a", "1"), finding("b", "2")},
+			wantAdded: []string{"a", "b"},
+		},
+		{
+			name:      "clean scan",
+			baseline:  []findings.Finding{finding("a", "1")},
+			wantFixed: []string{"a"},
+		},
+		{
+			name:          "added, fixed and unchanged",
+			current:       []findings.Finding{finding("a", "1"), finding("c", "3")},
+			baseline:      []findings.Finding{finding("a", "1"), finding("b", "2")},
+			wantAdded:     []string{"c"},
+			wantFixed:     []string{"b"},
+			wantUnchanged: 1,
+		},
+		{
+			// Findings are matched by fingerprint, not by rule
+			name:      "same rule elsewhere",
+			current:   []findings.Finding{finding("a", "2")},
+			baseline:  []findings.Finding{finding("a", "1")},
+			wantAdded: []string{"a"},
+			wantFixed: []string{"a"},
+		},
+		{
+			// A finding reported twice by the baseline is fixed once
+			name:      "duplicate baseline finding",
+			baseline:  []findings.Finding{finding("a", "1"), finding("a", "1")},
+			wantFixed: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r ScanResult
+			added := r.compareBaseline(tt.current, tt.baseline)
+
+			var got []string
+			for _, f := range added {
+				got = append(got, f.RuleID)
+			}
+			if !slices.Equal(got, tt.wantAdded) {
+				t.Errorf("compareBaseline() = %q, want %q", got, tt.wantAdded)
+			}
+			if len(r.Added) != len(tt.wantAdded) {
+				t.Errorf("Added = %q, want %d finding(s)", r.Added, len(tt.wantAdded))
+			}
+			if len(r.Fixed) != len(tt.wantFixed) {
+				t.Errorf("Fixed = %q, want %d finding(s)", r.Fixed, len(tt.wantFixed))
+			}
+			for i, want := range tt.wantFixed {
+				if i < len(r.Fixed) && !strings.Contains(r.Fixed[i], want) {
+					t.Errorf("Fixed[%d] = %q, want rule %q", i, r.Fixed[i], want)
+				}
+			}
+			if r.Unchanged != tt.wantUnchanged {
+				t.Errorf("Unchanged = %d, want %d", r.Unchanged, tt.wantUnchanged)
+			}
+		})
+	}
+}
+
+func TestCompareBaselineShiftedLines(t *testing.T) {
+	tests := []struct {
+		report string
+		// Line numbers moved by code added above the findings
+		shift *strings.Replacer
+	}{
+		{report: "gitleaks.json", shift: strings.NewReplacer(`"StartLine": 3`, `"StartLine": 10`, `"StartLine": 8`, `"StartLine": 15`)},
+		{report: "semgrep.json", shift: strings.NewReplacer(`"line": 12`, `"line": 40`, `"line": 7`, `"line": 9`)},
+		{report: "trivy-fs.json", shift: strings.NewReplacer(`"StartLine": 17`, `"StartLine": 21`, `"StartLine": 2`, `"StartLine": 3`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.report, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("findings", "testdata", tt.report))
+			if err != nil {
+				t.Fatal(err)
+			}
+			shifted := tt.shift.Replace(string(data))
+			if shifted == string(data) {
+				t.Fatal("no line shifted")
+			}
+
+			baseline, _, err := findings.Parse(tt.report, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			current, _, err := findings.Parse(tt.report, []byte(shifted))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var r ScanResult
+			if added := r.compareBaseline(current, baseline); len(added) > 0 {
+				t.Errorf("compareBaseline() = %q, want no new finding", r.Added)
+			}
+			if len(r.Fixed) > 0 || r.Unchanged != len(baseline) {
+				t.Errorf("fixed %q and %d unchanged, want %d unchanged", r.Fixed, r.Unchanged, len(baseline))
+			}
+		})
+	}
+}
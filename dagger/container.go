@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"dagger/devsecops/internal/dagger"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// registryPort is the port the local registry listens on
+const registryPort = 5000
+
+// parseBuildArgs reads NAME=VALUE build arguments
+func parseBuildArgs(buildArgs []string) ([]dagger.BuildArg, error) {
+	var parsed []dagger.BuildArg
+	for _, arg := range buildArgs {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid build argument %q (expected NAME=VALUE)", arg)
+		}
+		parsed = append(parsed, dagger.BuildArg{Name: name, Value: value})
+	}
+	return parsed, nil
+}
+
+// BuildImage builds the Dockerfile of the source into a container image, for
+// one platform. The image can be scanned with container-scanning --image and
+// pushed with publish-image --image.
+func (m *Devsecops) BuildImage(
+	// +required
+	source *dagger.Directory,
+	// Dockerfile, relative to the source
+	// +default="Dockerfile"
+	dockerfile string,
+	// Build arguments, as NAME=VALUE
+	// +optional
+	buildArgs []string,
+	// Target stage of a multi-stage Dockerfile
+	// +optional
+	target string,
+	// Platform to build for, e.g. "linux/arm64" (defaults to the engine platform)
+	// +optional
+	platform dagger.Platform,
+) (*dagger.Container, error) {
+	args, err := parseBuildArgs(buildArgs)
+	if err != nil {
+		return nil, err
+	}
+	return source.DockerBuild(dagger.DirectoryDockerBuildOpts{
+		Dockerfile: dockerfile,
+		BuildArgs:  args,
+		Target:     target,
+		Platform:   platform,
+	}), nil
+}
+
+// PublishImage pushes an image to a registry and returns its reference with
+// the pushed digest. The image is a container (e.g. built with build-image),
+// or built from the source for each platform into a multi-platform image.
+// With a registry service, such as a local registry:2, the image is pushed
+// to the service over plain HTTP instead, bound as the registry host of the
+// address.
+func (m *Devsecops) PublishImage(
+	ctx context.Context,
+	// Image reference, e.g. registry.example.com/group/app:tag
+	// (CI_REGISTRY_IMAGE:CI_COMMIT_SHORT_SHA), or registry:5000/app:tag with
+	// a registry service
+	// +required
+	address string,
+	// Image to push
+	// +optional
+	image *dagger.Container,
+	// Source to build the image from instead, with its Dockerfile
+	// +optional
+	source *dagger.Directory,
+	// Dockerfile, relative to the source
+	// +default="Dockerfile"
+	dockerfile string,
+	// Build arguments, as NAME=VALUE
+	// +optional
+	buildArgs []string,
+	// Target stage of a multi-stage Dockerfile
+	// +optional
+	target string,
+	// Platforms of the image built from the source, e.g. "linux/amd64,linux/arm64"
+	// (defaults to the engine platform)
+	// +optional
+	platforms []dagger.Platform,
+	// Registry username (CI_REGISTRY_USER)
+	// +optional
+	registryUsername string,
+	// Registry password or token (CI_REGISTRY_PASSWORD)
+	// +optional
+	registryPassword *dagger.Secret,
+	// Registry to push to instead of the registry of the address, e.g. a local
+	// registry:2 (--registry=tcp://localhost:5000)
+	// +optional
+	registry *dagger.Service,
+) (string, error) {
+	var variants []*dagger.Container
+	switch {
+	case image != nil && source != nil:
+		return "", fmt.Errorf("set either an image or a source to publish, not both")
+	case image != nil:
+		if len(platforms) > 0 {
+			return "", fmt.Errorf("platforms only apply to images built from a source")
+		}
+		variants = []*dagger.Container{image}
+	case source != nil:
+		if len(platforms) == 0 {
+			platforms = []dagger.Platform{""}
+		}
+		for _, platform := range platforms {
+			variant, err := m.BuildImage(source, dockerfile, buildArgs, target, platform)
+			if err != nil {
+				return "", err
+			}
+			variants = append(variants, variant)
+		}
+	default:
+		return "", fmt.Errorf("an image or a source is required to publish")
+	}
+
+	if registry != nil {
+		return m.pushToService(ctx, address, variants, registry)
+	}
+
+	fmt.Printf("📦 Publishing %s...\n", address)
+	publisher := dag.Container()
+	if registryUsername != "" && registryPassword != nil {
+		publisher = publisher.WithRegistryAuth(address, registryUsername, registryPassword)
+	}
+	ref, err := publisher.Publish(ctx, address, dagger.ContainerPublishOpts{PlatformVariants: variants})
+	if err != nil {
+		return "", fmt.Errorf("failed to publish %s: %w", address, err)
+	}
+	fmt.Printf("✅ Published %s\n", ref)
+	return ref, nil
+}
+
+// pushToService pushes image variants to a registry service with crane. The
+// engine cannot reach services, so the image is exported as an OCI layout and
+// pushed from a container bound to the service.
+func (m *Devsecops) pushToService(
+	ctx context.Context,
+	address string,
+	variants []*dagger.Container,
+	registry *dagger.Service,
+) (string, error) {
+	host, _, ok := strings.Cut(address, "/")
+	if !ok {
+		return "", fmt.Errorf("image reference %q has no registry host", address)
+	}
+	alias, _, _ := strings.Cut(host, ":")
+	alpine, err := m.image("alpine")
+	if err != nil {
+		return "", err
+	}
+	crane, err := m.image("crane")
+	if err != nil {
+		return "", err
+	}
+
+	layout := dag.Container().
+		From(alpine).
+		WithMountedFile("/image.tar", dag.Container().AsTarball(dagger.ContainerAsTarballOpts{PlatformVariants: variants})).
+		WithExec([]string{"sh", "-c", "mkdir -p /oci && tar -xf /image.tar -C /oci"}).
+		Directory("/oci")
+
+	args := []string{"push", "--insecure"}
+	if len(variants) > 1 {
+		args = append(args, "--index")
+	}
+	args = append(args, "/oci", address)
+
+	fmt.Printf("📦 Publishing %s to the registry service...\n", address)
+
+	// A push is a side effect on the registry: run it on every call
+	ref, err := dag.Container().
+		From(crane).
+		WithServiceBinding(alias, registry).
+		WithMountedDirectory("/oci", layout).
+		WithEnvVariable("DEVSECOPS_PUSHED_AT", time.Now().UTC().Format(time.RFC3339Nano)).
+		WithExec(args, dagger.ContainerWithExecOpts{UseEntrypoint: true}).
+		Stdout(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish %s: %w", address, err)
+	}
+	ref = strings.TrimSpace(ref)
+	fmt.Printf("✅ Published %s\n", ref)
+	return ref, nil
+}
+
+// LocalRegistry returns a registry:2 service listening on port 5000, to test
+// publishing locally:
+//
+//	dagger call local-registry up --ports=5000:5000
+func (m *Devsecops) LocalRegistry() (*dagger.Service, error) {
+	image, err := m.image("distribution")
+	if err != nil {
+		return nil, err
+	}
+	return dag.Container().
+		From(image).
+		WithExposedPort(registryPort).
+		AsService(dagger.ContainerAsServiceOpts{UseEntrypoint: true}), nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"dagger/devsecops/internal/dagger"
+	"slices"
+)
+
+// packageCacheEnv maps package managers to the environment variable setting
+// their download cache directory. Python tools are all installed with pip.
+var packageCacheEnv = map[string]string{
+	"npm":      "npm_config_cache",
+	"pnpm":     "npm_config_store_dir",
+	"yarn":     "YARN_CACHE_FOLDER",
+	"bun":      "BUN_INSTALL_CACHE_DIR",
+	"pip":      "PIP_CACHE_DIR",
+	"poetry":   "PIP_CACHE_DIR",
+	"uv":       "PIP_CACHE_DIR",
+	"pipenv":   "PIP_CACHE_DIR",
+	"composer": "COMPOSER_CACHE_DIR",
+}
+
+// installFiles are the package manager configuration files installs read
+// besides the manifests and lock files of the project
+var installFiles = []string{
+	".npmrc", ".yarnrc", ".yarnrc.yml", ".yarn/releases/**", ".yarn/plugins/**", ".yarn/patches/**",
+	"pnpm-workspace.yaml", "patches/**",
+	"pip.conf",
+	"auth.json",
+}
+
+// packageCache returns a container option mounting the download cache of the
+// project package manager, in a cache volume per package manager shared by all
+// projects and lock file versions, so installs only download the packages
+// missing from it
+func packageCache(project *Project) dagger.WithContainerFunc {
+	env, ok := packageCacheEnv[project.PackageManager]
+	if !ok {
+		return func(ctr *dagger.Container) *dagger.Container { return ctr }
+	}
+
+	dir := "/cache/" + project.PackageManager
+	volume := dag.CacheVolume("devsecops-" + project.PackageManager)
+	return func(ctr *dagger.Container) *dagger.Container {
+		return ctr.
+			WithMountedCache(dir, volume).
+			WithEnvVariable(env, dir)
+	}
+}
+
+// installDependencies runs the install commands of the project in /src of a
+// container, with the package cache and only the manifests, lock files and
+// package manager configuration of the source, then adds the rest of the
+// source. Changes to other files reuse the cached install step.
+func installDependencies(container *dagger.Container, source *dagger.Directory, project *Project, installs ...[]string) *dagger.Container {
+	container = container.
+		With(packageCache(project)).
+		WithDirectory("/src", source, dagger.ContainerWithDirectoryOpts{
+			Include: slices.Concat(project.Manifests, installFiles),
+		}).
+		WithWorkdir("/src")
+	for _, install := range installs {
+		container = container.WithExec(install)
+	}
+	return container.WithDirectory("/src", source)
+}
+
+// nodeDependencies returns a Node.js container with the source in /src and
+// its dependencies installed. BuildNode and TestNode share this step: within
+// a run, identical sources install their dependencies once.
+func (m *Devsecops) nodeDependencies(source *dagger.Directory, project *Project, nodeVersion string) (*dagger.Container, error) {
+	image, err := m.versionedImage("node", "node:%s-alpine", nodeVersion)
+	if err != nil {
+		return nil, err
+	}
+	return installNodeDependencies(dag.Container().From(image), source, project), nil
+}
+
+// installNodeDependencies adds the source in /src of a container with Node.js
+// and installs its dependencies with the project package manager
+func installNodeDependencies(container *dagger.Container, source *dagger.Directory, project *Project) *dagger.Container {
+	container = container.WithExec([]string{"corepack", "enable"})
+
+	switch project.PackageManager {
+	case "pnpm":
+		return installDependencies(container, source, project, []string{"pnpm", "install", "--frozen-lockfile"})
+	case "yarn":
+		return installDependencies(container, source, project, []string{"yarn", "install", "--frozen-lockfile"})
+	case "bun":
+		return installDependencies(container, source, project,
+			[]string{"npm", "install", "-g", "bun"},
+			[]string{"bun", "install", "--frozen-lockfile"})
+	default:
+		return installDependencies(container, source, project, []string{"npm", "ci"})
+	}
+}
+
+// pythonDependencies returns a Python container with the source in /src and
+// the requirements.txt dependencies, if any, installed. BuildPython and
+// TestPython share this step.
+func (m *Devsecops) pythonDependencies(source *dagger.Directory, project *Project, pythonVersion string) (*dagger.Container, error) {
+	image, err := m.versionedImage("python", "python:%s-slim", pythonVersion)
+	if err != nil {
+		return nil, err
+	}
+	return installDependencies(dag.Container().From(image), source, project,
+		[]string{"python", "-m", "pip", "install", "-U", "pip"},
+		[]string{"sh", "-c", `if [ -f "requirements.txt" ]; then pip install -r requirements.txt; fi`}), nil
+}
+
+// phpDependencies returns a PHP container with Composer, the unzip and git
+// commands Composer installs packages with, the source in /src and its
+// dependencies installed. BuildPhp and TestPhp share this step. The autoloader
+// is dumped, with the Composer scripts hooked on it, once the source is in
+// place.
+func (m *Devsecops) phpDependencies(source *dagger.Directory, project *Project, phpVersion string) (*dagger.Container, error) {
+	image, err := m.versionedImage("php", "php:%s-cli", phpVersion)
+	if err != nil {
+		return nil, err
+	}
+	container := dag.Container().
+		From(image).
+		WithExec([]string{"sh", "-c", "apt-get update && apt-get install -y --no-install-recommends git unzip && rm -rf /var/lib/apt/lists/*"}).
+		WithExec([]string{"sh", "-c", "curl -sS https://getcomposer.org/installer | php -- --install-dir=/usr/local/bin --filename=composer"})
+	return installDependencies(container, source, project,
+		[]string{"composer", "install", "--no-interaction", "--prefer-dist", "--no-autoloader", "--no-scripts"}).
+		WithExec([]string{"composer", "dump-autoload", "--optimize"}), nil
+}
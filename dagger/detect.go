@@ -0,0 +1,222 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/devsecops/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Project describes the language and package manager of a source tree
+type Project struct {
+	// Project language (node, python, php, generic), as in DEVSECOPS_PROJECT_LANGUAGE
+	Language string
+	// Package manager (npm, pnpm, yarn, bun, pip, poetry, uv, pipenv, composer; empty for generic)
+	PackageManager string
+	// Manifest and lock files the detection was based on
+	Manifests []string
+}
+
+// Manifest and lock files inspected by the detection, by language
+var projectManifests = map[string][]string{
+	"node": {
+		"package.json", "package-lock.json", "npm-shrinkwrap.json",
+		"pnpm-lock.yaml", "yarn.lock", "bun.lockb", "bun.lock",
+	},
+	"python": {
+		"requirements.txt", "pyproject.toml", "poetry.lock", "uv.lock",
+		"Pipfile", "Pipfile.lock", "setup.py",
+	},
+	"php": {"composer.json", "composer.lock"},
+}
+
+// Detect inspects a source directory and reports its language and package manager
+func (m *Devsecops) Detect(
+	ctx context.Context,
+	// +required
+	source *dagger.Directory,
+) (*Project, error) {
+	return resolveProject(ctx, source, "auto", "auto")
+}
+
+// maxDiscoveryDepth limits how deep subprojects are searched for
+const maxDiscoveryDepth = 3
+
+// Directories never treated as subprojects
+var skippedDirs = []string{
+	"node_modules", "vendor", ".git", ".venv", "venv", "__pycache__", "dist", "build",
+}
+
+// discoverProjects finds the projects of a monorepo: the source root and the
+// directories up to maxDiscoveryDepth levels deep containing a manifest or
+// lock file, excluding dependency and build directories. Directories inside a
+// discovered project are scanned with it and not returned, so a manifest at
+// the root makes the whole source a single project.
+func discoverProjects(ctx context.Context, source *dagger.Directory) ([]string, error) {
+	var dirs []string
+	for _, language := range []string{"node", "python", "php"} {
+		for _, manifest := range projectManifests[language] {
+			for depth := 0; depth <= maxDiscoveryDepth; depth++ {
+				matches, err := source.Glob(ctx, strings.Repeat("*/", depth)+manifest)
+				if err != nil {
+					return nil, fmt.Errorf("failed to discover subprojects: %w", err)
+				}
+				for _, match := range matches {
+					dir := path.Dir(match)
+					if slices.Contains(dirs, dir) ||
+						slices.ContainsFunc(strings.Split(dir, "/"), func(segment string) bool {
+							return slices.Contains(skippedDirs, segment)
+						}) {
+						continue
+					}
+					dirs = append(dirs, dir)
+				}
+			}
+		}
+	}
+
+	// Keep the outermost projects: parents sort before their subdirectories
+	slices.SortFunc(dirs, func(a, b string) int {
+		return cmp.Or(cmp.Compare(pathDepth(a), pathDepth(b)), cmp.Compare(a, b))
+	})
+	var paths []string
+	for _, dir := range dirs {
+		if !slices.ContainsFunc(paths, func(project string) bool { return withinPath(dir, project) }) {
+			paths = append(paths, dir)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no projects found: no manifest files in the source")
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// pathDepth returns the number of directories in a relative path ("." is 0)
+func pathDepth(p string) int {
+	if p == "." {
+		return 0
+	}
+	return strings.Count(p, "/") + 1
+}
+
+// withinPath reports whether a relative path is dir itself or below it
+func withinPath(p, dir string) bool {
+	return dir == "." || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// resolveProject resolves "auto" language and package manager values by
+// inspecting the top level of the source directory. Explicit values are kept.
+func resolveProject(ctx context.Context, source *dagger.Directory, language, packageManager string) (*Project, error) {
+	entries, err := source.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source directory: %w", err)
+	}
+
+	files := map[string]bool{}
+	for _, entry := range entries {
+		files[entry] = true
+	}
+
+	project := &Project{Language: language, PackageManager: packageManager}
+	if language == "" || language == "auto" {
+		project.Language = detectLanguage(files)
+	}
+
+	if packageManager == "" || packageManager == "auto" {
+		project.PackageManager = ""
+		switch project.Language {
+		case "node":
+			packageJSON := ""
+			if files["package.json"] {
+				packageJSON, _ = source.File("package.json").Contents(ctx)
+			}
+			project.PackageManager = detectNodePackageManager(files, packageJSON)
+		case "python":
+			project.PackageManager = detectPythonPackageManager(files)
+		case "php":
+			project.PackageManager = "composer"
+		}
+	}
+
+	for _, manifest := range projectManifests[project.Language] {
+		if files[manifest] {
+			project.Manifests = append(project.Manifests, manifest)
+		}
+	}
+
+	if language == "auto" || packageManager == "auto" {
+		fmt.Printf("🔎 Detected %s\n", project.describe())
+	}
+	return project, nil
+}
+
+// describe summarizes the project for log output
+func (p *Project) describe() string {
+	s := p.Language
+	if p.PackageManager != "" {
+		s += " (" + p.PackageManager + ")"
+	}
+	if len(p.Manifests) > 0 {
+		s += " from " + strings.Join(p.Manifests, ", ")
+	}
+	return s
+}
+
+// detectLanguage picks the project language from its manifests. PHP and
+// Python projects often ship a package.json for frontend assets, so their
+// manifests take precedence over Node.js ones.
+func detectLanguage(files map[string]bool) string {
+	for _, language := range []string{"php", "python", "node"} {
+		if slices.ContainsFunc(projectManifests[language], func(manifest string) bool { return files[manifest] }) {
+			return language
+		}
+	}
+	return "generic"
+}
+
+// detectNodePackageManager picks the package manager from the lock file,
+// falling back to the corepack "packageManager" field of package.json.
+func detectNodePackageManager(files map[string]bool, packageJSON string) string {
+	switch {
+	case files["pnpm-lock.yaml"]:
+		return "pnpm"
+	case files["yarn.lock"]:
+		return "yarn"
+	case files["bun.lockb"] || files["bun.lock"]:
+		return "bun"
+	case files["package-lock.json"] || files["npm-shrinkwrap.json"]:
+		return "npm"
+	}
+
+	var manifest struct {
+		PackageManager string `json:"packageManager"`
+	}
+	if json.Unmarshal([]byte(packageJSON), &manifest) == nil {
+		name, _, _ := strings.Cut(manifest.PackageManager, "@")
+		switch name {
+		case "pnpm", "yarn", "bun", "npm":
+			return name
+		}
+	}
+	return "npm"
+}
+
+// detectPythonPackageManager picks the package manager from the lock file
+func detectPythonPackageManager(files map[string]bool) string {
+	switch {
+	case files["poetry.lock"]:
+		return "poetry"
+	case files["uv.lock"]:
+		return "uv"
+	case files["Pipfile.lock"] || files["Pipfile"]:
+		return "pipenv"
+	default:
+		return "pip"
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"dagger/devsecops/internal/dagger"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// e2eAppAlias is the hostname the application tested by TestE2e is bound to
+	e2eAppAlias = "app"
+	// e2eResultsDir is where E2E runs write their JUnit report, traces and
+	// screenshots, relative to the source
+	e2eResultsDir = "e2e-results"
+)
+
+// nodeRunScript returns the command running a package.json script with a
+// package manager
+func nodeRunScript(packageManager, script string) []string {
+	switch packageManager {
+	case "pnpm", "yarn", "bun":
+		return []string{packageManager, "run", script}
+	default:
+		return []string{"npm", "run", script}
+	}
+}
+
+// nodeExec returns the command running a binary of the project dependencies
+// with a package manager
+func nodeExec(packageManager string, args ...string) []string {
+	var cmd []string
+	switch packageManager {
+	case "pnpm":
+		cmd = []string{"pnpm", "exec"}
+	case "yarn":
+		cmd = []string{"yarn"}
+	case "bun":
+		cmd = []string{"bunx"}
+	default:
+		cmd = []string{"npx", "--no-install"}
+	}
+	return append(cmd, args...)
+}
+
+// e2eApp builds the application of a Node.js project, when it has a build
+// script, and starts it as a service listening on port
+func (m *Devsecops) e2eApp(
+	ctx context.Context,
+	source *dagger.Directory,
+	project *Project,
+	nodeVersion string,
+	startCommand string,
+	port int,
+) (*dagger.Service, error) {
+	container, err := m.nodeDependencies(source, project, nodeVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	build := fmt.Sprintf(
+		`if node -e "process.exit(require('./package.json').scripts?.build ? 0 : 1)"; then %s; fi`,
+		strings.Join(nodeRunScript(project.PackageManager, "build"), " "),
+	)
+	start := nodeRunScript(project.PackageManager, "start")
+	if startCommand != "" {
+		start = []string{"sh", "-c", startCommand}
+	}
+
+	return container.
+		WithExec([]string{"sh", "-c", build}).
+		WithEnvVariable("PORT", strconv.Itoa(port)).
+		WithEnvVariable("HOST", "0.0.0.0").
+		WithExposedPort(port).
+		AsService(dagger.ContainerAsServiceOpts{Args: start}), nil
+}
+
+// TestE2e runs the Playwright or Cypress end-to-end tests of a Node.js
+// project against the application. The application is built from the source
+// and started as a service reachable at http://app:<port>, or tested where it
+// is deployed with --target-url. The tests get the URL in BASE_URL (and as the
+// Cypress baseUrl), and write their JUnit report, traces, screenshots and
+// videos to e2e-results/ in the reports, also when they fail.
+func (m *Devsecops) TestE2e(
+	ctx context.Context,
+	// +required
+	source *dagger.Directory,
+	// E2E framework (playwright, cypress)
+	// +default="playwright"
+	framework string,
+	// Directory of the E2E tests, relative to the source
+	// +default="e2e"
+	testDir string,
+	// URL of a deployed application to test instead of starting the
+	// application (DEVSECOPS_STAGING_URL)
+	// +optional
+	targetUrl string,
+	// Command starting the application (defaults to its start script)
+	// +optional
+	startCommand string,
+	// Port the application listens on, also passed to it as PORT
+	// +default=3000
+	port int,
+	// Node.js version of the application (defaults to the configured node image)
+	// +optional
+	nodeVersion string,
+	// Package manager (auto, npm, pnpm, yarn, bun)
+	// +default="auto"
+	packageManager string,
+) (*TestResult, error) {
+	var runner string
+	switch framework {
+	case "playwright":
+		runner = "Playwright"
+	case "cypress":
+		runner = "Cypress"
+	default:
+		return nil, fmt.Errorf("unknown E2E framework %q (expected \"playwright\" or \"cypress\")", framework)
+	}
+	if _, err := source.Directory(testDir).Entries(ctx); err != nil {
+		return nil, fmt.Errorf("no E2E test directory %s in the source: %w", testDir, err)
+	}
+
+	project, err := resolveProject(ctx, source, "node", packageManager)
+	if err != nil {
+		return nil, err
+	}
+
+	// The framework image provides the browsers; the tests run with the
+	// framework version of the project dependencies
+	image, err := m.image(framework)
+	if err != nil {
+		return nil, err
+	}
+	container := installNodeDependencies(dag.Container().From(image), source, project)
+
+	if targetUrl == "" {
+		app, err := m.e2eApp(ctx, source, project, nodeVersion, startCommand, port)
+		if err != nil {
+			return nil, err
+		}
+		container = container.WithServiceBinding(e2eAppAlias, app)
+		targetUrl = fmt.Sprintf("http://%s:%d", e2eAppAlias, port)
+	}
+
+	fmt.Printf("🎭 Running %s E2E tests in %s against %s...\n", runner, testDir, targetUrl)
+
+	var cmd []string
+	switch framework {
+	case "playwright":
+		container = container.
+			WithEnvVariable("PLAYWRIGHT_JUNIT_OUTPUT_NAME", e2eResultsDir+"/junit.xml").
+			WithEnvVariable("PLAYWRIGHT_HTML_OUTPUT_DIR", e2eResultsDir+"/html").
+			WithEnvVariable("PLAYWRIGHT_HTML_REPORT", e2eResultsDir+"/html").
+			WithEnvVariable("PLAYWRIGHT_HTML_OPEN", "never")
+		cmd = nodeExec(project.PackageManager, "playwright", "test", testDir,
+			"--reporter=list,junit,html",
+			"--output="+e2eResultsDir+"/artifacts",
+			"--trace=retain-on-failure",
+		)
+	case "cypress":
+		cmd = nodeExec(project.PackageManager, "cypress", "run",
+			"--spec", testDir+"/**/*.cy.{js,jsx,ts,tsx}",
+			"--reporter", "junit",
+			"--reporter-options", "mochaFile="+e2eResultsDir+"/junit-[hash].xml",
+			"--config", fmt.Sprintf("baseUrl=%s,screenshotsFolder=%s/screenshots,videosFolder=%s/videos",
+				targetUrl, e2eResultsDir, e2eResultsDir),
+		)
+	}
+
+	container = container.
+		WithEnvVariable("BASE_URL", targetUrl).
+		WithExec([]string{"mkdir", "-p", e2eResultsDir})
+
+	return runTests(ctx, container, runner, cmd, 0, e2eResultsDir)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"dagger/devsecops/findings"
+	"dagger/devsecops/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+)
+
+// findingsReport is the JSON document returned by Findings
+type findingsReport struct {
+	Total    int                       `json:"total"`
+	Severity map[findings.Severity]int `json:"severity"`
+	Tools    map[string]int            `json:"tools"`
+	Findings []findings.Finding        `json:"findings"`
+}
+
+// Findings parses every report in a reports directory (e.g. the reports of a Test run)
+// into normalized, de-duplicated findings and returns them as JSON
+func (m *Devsecops) Findings(
+	ctx context.Context,
+	// Directory containing scanner reports (gitleaks-report.json, dependency-scan.json, ...)
+	// +required
+	reports *dagger.Directory,
+) (string, error) {
+	fmt.Println("🧾 Normalizing security findings...")
+
+	parsed, err := loadFindings(ctx, reports)
+	if err != nil {
+		return "", err
+	}
+
+	report := findingsReport{
+		Total:    len(parsed),
+		Severity: findings.CountBySeverity(parsed),
+		Tools:    map[string]int{},
+		Findings: parsed,
+	}
+	if report.Findings == nil {
+		report.Findings = []findings.Finding{}
+	}
+	for _, f := range parsed {
+		report.Tools[f.Tool]++
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// ToSarif converts every report in a reports directory into a single SARIF
+// 2.1.0 log with one run per tool, e.g. for GitHub code scanning. Findings
+// reported by several tools appear once, under the first tool. File locations
+// are relative to the reports directory, i.e. to the repository root for the
+// reports of a monorepo Test run.
+func (m *Devsecops) ToSarif(
+	ctx context.Context,
+	// Directory containing scanner reports (gitleaks-report.json, dependency-scan.json, ...)
+	// +required
+	reports *dagger.Directory,
+) (*dagger.File, error) {
+	fmt.Println("🧾 Converting security findings to SARIF...")
+
+	parsed, err := loadFindings(ctx, reports)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := findings.MarshalSarif(parsed)
+	if err != nil {
+		return nil, err
+	}
+	return dag.Directory().WithNewFile("results.sarif", string(out)+"\n").File("results.sarif"), nil
+}
+
+// loadFindings parses all JSON reports found in a directory and de-duplicates
+// the findings across tools
+func loadFindings(ctx context.Context, reports *dagger.Directory) ([]findings.Finding, error) {
+	parsed, err := parseReports(ctx, reports)
+	if err != nil {
+		return nil, err
+	}
+	return findings.Dedupe(parsed), nil
+}
+
+// parseReports parses all JSON reports found in a directory, with file
+// locations relative to its root. Reports in an unknown format are skipped.
+func parseReports(ctx context.Context, reports *dagger.Directory) ([]findings.Finding, error) {
+	paths, err := reports.Glob(ctx, "**/*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+	slices.Sort(paths)
+
+	var all []findings.Finding
+	for _, path := range paths {
+		contents, err := reports.File(path).Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report %s: %w", path, err)
+		}
+
+		parsed, format, err := findings.Parse(path, []byte(contents))
+		if err != nil {
+			return nil, err
+		}
+		if format == findings.FormatUnknown {
+			fmt.Printf("→ Skipping %s (no recognized findings format)\n", path)
+			continue
+		}
+		fmt.Printf("→ %s: %d finding(s) from %s\n", path, len(parsed), format)
+		rootRelative(path, parsed)
+		all = append(all, parsed...)
+	}
+
+	return all, nil
+}
+
+// rootRelative makes the file locations and fingerprints of the findings of a
+// report relative to the root of the reports directory: the reports of a
+// monorepo run live under their subproject path, and their locations are
+// relative to it. Container scan targets are images rather than files and are
+// kept as is.
+func rootRelative(report string, parsed []findings.Finding) {
+	if path.Base(report) == "trivy.json" {
+		return
+	}
+	findings.Relocate(parsed, path.Dir(report))
+}
@@ -0,0 +1,260 @@
+// Package findings normalizes the reports produced by the DevSecOps templates
+// (Gitleaks, Trivy, npm audit, pip-audit, composer audit, Semgrep, Polaris and
+// OWASP ZAP) into a single Finding model.
+package findings
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Severity is a normalized finding severity
+type Severity string
+
+const (
+	SeverityCritical Severity = "CRITICAL"
+	SeverityHigh     Severity = "HIGH"
+	SeverityMedium   Severity = "MEDIUM"
+	SeverityLow      Severity = "LOW"
+	SeverityInfo     Severity = "INFO"
+	SeverityUnknown  Severity = "UNKNOWN"
+)
+
+// Severities lists all severities from most to least severe
+var Severities = []Severity{
+	SeverityCritical,
+	SeverityHigh,
+	SeverityMedium,
+	SeverityLow,
+	SeverityInfo,
+	SeverityUnknown,
+}
+
+// ParseSeverity maps a tool-specific severity label to a Severity.
+// Unrecognized labels map to SeverityUnknown.
+func ParseSeverity(s string) Severity {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "CRITICAL":
+		return SeverityCritical
+	case "HIGH", "ERROR", "DANGER":
+		return SeverityHigh
+	case "MEDIUM", "MODERATE", "WARNING":
+		return SeverityMedium
+	case "LOW", "NOTE", "NEGLIGIBLE":
+		return SeverityLow
+	case "INFO", "INFORMATIONAL", "NONE":
+		return SeverityInfo
+	default:
+		return SeverityUnknown
+	}
+}
+
+// Rank orders severities: higher is more severe. Unknown ranks below Info.
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityCritical:
+		return 5
+	case SeverityHigh:
+		return 4
+	case SeverityMedium:
+		return 3
+	case SeverityLow:
+		return 2
+	case SeverityInfo:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Finding categories
+const (
+	CategorySecret        = "secret"
+	CategoryVulnerability = "vulnerability"
+	CategorySast          = "sast"
+	CategoryMisconfig     = "misconfig"
+	CategoryDast          = "dast"
+)
+
+// Finding is a single normalized security finding
+type Finding struct {
+	// Tool that reported the finding (gitleaks, trivy, npm-audit, ...)
+	Tool string `json:"tool"`
+	// Finding category (secret, vulnerability, sast, misconfig, dast)
+	Category string `json:"category"`
+	// Rule, check or advisory identifier (CVE, GHSA, Semgrep check id, ...)
+	RuleID string `json:"rule_id"`
+	// Alternative identifiers of the same advisory
+	Aliases  []string `json:"aliases,omitempty"`
+	Severity Severity `json:"severity"`
+	Title    string   `json:"title,omitempty"`
+	// Source location, for code findings
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	// Non-file location: URL for DAST, Kubernetes object for Polaris
+	Location string `json:"location,omitempty"`
+	// Affected package, for dependency findings
+	Package      string `json:"package,omitempty"`
+	Version      string `json:"version,omitempty"`
+	FixedVersion string `json:"fixed_version,omitempty"`
+	// Code or match reported by the tool, which identifies code findings
+	// independently of their line. Never serialized: it may hold a secret.
+	Snippet string `json:"-"`
+	// Stable identifier used for de-duplication and baselines
+	Fingerprint string `json:"fingerprint"`
+	// Report file the finding was read from
+	Report string `json:"report,omitempty"`
+	// Other tools that reported the same finding
+	AlsoReportedBy []string `json:"also_reported_by,omitempty"`
+}
+
+// computeFingerprint derives a stable identifier from the identifying fields
+// of a finding. Code findings are keyed by rule, file and normalized snippet
+// rather than line, so they keep their fingerprint when lines shift.
+// occurrence tells apart the findings of a report sharing all those fields
+// (e.g. the same snippet twice in a file), in report order.
+func computeFingerprint(f *Finding, occurrence int) string {
+	var parts []string
+	switch f.Category {
+	case CategoryVulnerability:
+		parts = []string{f.Category, f.RuleID, strings.ToLower(f.Package), f.Version}
+	default:
+		parts = []string{f.Category, f.RuleID, f.File, f.Location, strings.Join(strings.Fields(f.Snippet), " ")}
+	}
+	if occurrence > 1 {
+		parts = append(parts, strconv.Itoa(occurrence))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// fingerprint sets the fingerprints of the findings of a report. The same
+// vulnerability in several targets shares a fingerprint, so Dedupe merges it;
+// other findings with identical fields are numbered.
+func fingerprint(findings []Finding) {
+	occurrences := map[string]int{}
+	for i := range findings {
+		f := &findings[i]
+		f.Fingerprint = computeFingerprint(f, 1)
+		if f.Category == CategoryVulnerability {
+			continue
+		}
+		occurrences[f.Fingerprint]++
+		if n := occurrences[f.Fingerprint]; n > 1 {
+			f.Fingerprint = computeFingerprint(f, n)
+		}
+	}
+}
+
+// Relocate prefixes the file locations of the findings of a report with dir,
+// e.g. the subproject path of a monorepo report, and recomputes their
+// fingerprints: the same code finding in two subprojects stays two findings.
+func Relocate(findings []Finding, dir string) {
+	if dir == "" || dir == "." {
+		return
+	}
+	for i := range findings {
+		if findings[i].File != "" {
+			findings[i].File = path.Join(dir, findings[i].File)
+		}
+	}
+	fingerprint(findings)
+}
+
+// dedupeKeys returns every key under which a finding can match another one.
+// Vulnerabilities also match through their aliases (e.g. a GHSA id reported by
+// npm audit and the corresponding CVE reported by Trivy).
+func dedupeKeys(f *Finding) []string {
+	keys := []string{f.Fingerprint}
+	if f.Category == CategoryVulnerability {
+		pkg := strings.ToLower(f.Package)
+		for _, id := range append([]string{f.RuleID}, f.Aliases...) {
+			keys = append(keys, strings.Join([]string{f.Category, id, pkg}, "|"))
+		}
+	}
+	return keys
+}
+
+// Dedupe merges findings reported by several tools into one. The first
+// occurrence is kept, its severity raised to the highest reported one and
+// missing details filled in from the duplicates.
+func Dedupe(findings []Finding) []Finding {
+	var out []Finding
+	index := map[string]int{}
+
+	for _, f := range findings {
+		keys := dedupeKeys(&f)
+
+		existing := -1
+		for _, key := range keys {
+			if i, ok := index[key]; ok {
+				existing = i
+				break
+			}
+		}
+
+		if existing < 0 {
+			out = append(out, f)
+			existing = len(out) - 1
+		} else {
+			merge(&out[existing], &f)
+		}
+
+		for _, key := range keys {
+			index[key] = existing
+		}
+	}
+
+	return out
+}
+
+func merge(dst, src *Finding) {
+	if src.Tool != dst.Tool && !slices.Contains(dst.AlsoReportedBy, src.Tool) {
+		dst.AlsoReportedBy = append(dst.AlsoReportedBy, src.Tool)
+	}
+	if src.Severity.Rank() > dst.Severity.Rank() {
+		dst.Severity = src.Severity
+	}
+	for _, alias := range append([]string{src.RuleID}, src.Aliases...) {
+		if alias != dst.RuleID && !slices.Contains(dst.Aliases, alias) {
+			dst.Aliases = append(dst.Aliases, alias)
+		}
+	}
+	if dst.Title == "" {
+		dst.Title = src.Title
+	}
+	if dst.Version == "" {
+		dst.Version = src.Version
+	}
+	if dst.FixedVersion == "" {
+		dst.FixedVersion = src.FixedVersion
+	}
+}
+
+// CountBySeverity counts findings per severity
+func CountBySeverity(findings []Finding) map[Severity]int {
+	counts := map[Severity]int{}
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	return counts
+}
+
+// sortFindings orders findings deterministically. Parsers iterating over JSON
+// objects use it so that reports always yield findings in the same order.
+func sortFindings(findings []Finding) {
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return cmp.Or(
+			cmp.Compare(a.Package, b.Package),
+			cmp.Compare(a.RuleID, b.RuleID),
+			cmp.Compare(a.Location, b.Location),
+			cmp.Compare(a.File, b.File),
+			cmp.Compare(a.Line, b.Line),
+		)
+	})
+}
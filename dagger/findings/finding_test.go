@@ -0,0 +1,69 @@
+package findings
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRelocate(t *testing.T) {
+	tests := []struct {
+		report string
+		// Findings left once the reports of both subprojects are merged
+		want int
+	}{
+		// Code findings are kept per subproject
+		{report: "semgrep.json", want: 4},
+		{report: "gitleaks.json", want: 4},
+		// The same vulnerability in both subprojects is merged
+		{report: "trivy-fs.json", want: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.report, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.report))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var all []Finding
+			for _, dir := range []string{"frontend", "backend"} {
+				parsed, _, err := Parse(dir+"/"+tt.report, data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				unprefixed := slices.Clone(parsed)
+				Relocate(parsed, dir)
+
+				for i, f := range parsed {
+					if want := filepath.ToSlash(filepath.Join(dir, unprefixed[i].File)); unprefixed[i].File != "" && f.File != want {
+						t.Errorf("file = %q, want %q", f.File, want)
+					}
+					if f.Category != CategoryVulnerability && f.Fingerprint == unprefixed[i].Fingerprint {
+						t.Errorf("%s: fingerprint not recomputed after relocation", f)
+					}
+				}
+				all = append(all, parsed...)
+			}
+
+			if got := len(Dedupe(all)); got != tt.want {
+				t.Errorf("Dedupe() = %d finding(s), want %d", got, tt.want)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(filepath.Join("testdata", "semgrep.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := Parse("semgrep.json", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged := slices.Clone(parsed)
+	Relocate(parsed, ".")
+	if !slices.EqualFunc(parsed, unchanged, func(a, b Finding) bool { return a.File == b.File && a.Fingerprint == b.Fingerprint }) {
+		t.Error("Relocate() changed the findings of a report at the root")
+	}
+}
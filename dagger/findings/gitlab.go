@@ -0,0 +1,386 @@
+package findings
+
+import (
+	"bytes"
+	"cmp"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+// GitlabSchemaVersion is the version of the GitLab security report schemas
+// the converted reports conform to, vendored in schemas/
+const GitlabSchemaVersion = "15.2.1"
+
+//go:generate bash schemas/fetch.sh 15.2.1
+
+// gitlabSchemas holds the vendored <type>-report-format.json schemas
+//
+//go:embed schemas
+var gitlabSchemas embed.FS
+
+// GitLab security report types, as declared under artifacts:reports
+const (
+	GitlabSecretDetection    = "secret_detection"
+	GitlabSast               = "sast"
+	GitlabDependencyScanning = "dependency_scanning"
+	GitlabContainerScanning  = "container_scanning"
+	GitlabDast               = "dast"
+)
+
+// GitlabReportTypes lists the report types in conversion order
+var GitlabReportTypes = []string{
+	GitlabSecretDetection,
+	GitlabSast,
+	GitlabDependencyScanning,
+	GitlabContainerScanning,
+	GitlabDast,
+}
+
+// GitlabReportFile returns the conventional artifact name of a report type
+// (e.g. gl-sast-report.json)
+func GitlabReportFile(reportType string) string {
+	return "gl-" + strings.ReplaceAll(reportType, "_", "-") + "-report.json"
+}
+
+// ValidateGitlabReport validates a GitLab security report against the
+// vendored schema of its type, and returns the schema violations, each as
+// "<JSON pointer>: <problem>"
+func ValidateGitlabReport(reportType string, data []byte) ([]string, error) {
+	file := "schemas/" + strings.ReplaceAll(reportType, "_", "-") + "-report-format.json"
+	contents, err := gitlabSchemas.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("GitLab %s schema %s is not vendored: run go generate ./findings", reportType, GitlabSchemaVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+	violations, err := validateJSON(file, contents, data)
+	if err != nil {
+		return nil, fmt.Errorf("GitLab %s schema: %w", reportType, err)
+	}
+	return violations, nil
+}
+
+// validateJSON validates a JSON document against a JSON schema, and returns
+// its violations sorted by location. A document that is not JSON returns an
+// error.
+func validateJSON(file string, schemaData, data []byte) ([]string, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaData))
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(file, doc); err != nil {
+		return nil, err
+	}
+	schema, err := compiler.Compile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	err = schema.Validate(value)
+	var invalid *jsonschema.ValidationError
+	if !errors.As(err, &invalid) {
+		return nil, err
+	}
+	var violations []string
+	for _, unit := range invalid.BasicOutput().Errors {
+		switch unit.Error.Kind.(type) {
+		case *kind.Schema, *kind.Group, *kind.Reference:
+			// only wrap the violations of subschemas
+		default:
+			violations = append(violations, unit.InstanceLocation+": "+unit.Error.String())
+		}
+	}
+	slices.Sort(violations)
+	return violations, nil
+}
+
+// gitlabReportTypes maps the template artifacts to the report type they feed
+var gitlabReportTypes = map[string]string{
+	"secrets-report.json":  GitlabSecretDetection,
+	"gitleaks-report.json": GitlabSecretDetection,
+	"sast-report.json":     GitlabSast,
+	"semgrep.json":         GitlabSast,
+	"iac-report.json":      GitlabSast,
+	"polaris.json":         GitlabSast,
+	"dependency-scan.json": GitlabDependencyScanning,
+	"trivy.json":           GitlabContainerScanning,
+	"zap.json":             GitlabDast,
+}
+
+// GitlabReportType returns the GitLab report type of a scanner report, from
+// its artifact name or, for other names, the category of its findings. ok is
+// false when the report cannot be classified.
+func GitlabReportType(report string, findings []Finding) (reportType string, ok bool) {
+	if reportType, ok := gitlabReportTypes[path.Base(report)]; ok {
+		return reportType, true
+	}
+	if len(findings) == 0 {
+		return "", false
+	}
+	switch findings[0].Category {
+	case CategorySecret:
+		return GitlabSecretDetection, true
+	case CategorySast, CategoryMisconfig:
+		return GitlabSast, true
+	case CategoryVulnerability:
+		return GitlabDependencyScanning, true
+	case CategoryDast:
+		return GitlabDast, true
+	}
+	return "", false
+}
+
+type gitlabReport struct {
+	Version         string                `json:"version"`
+	Scan            gitlabScan            `json:"scan"`
+	Vulnerabilities []gitlabVulnerability `json:"vulnerabilities"`
+}
+
+type gitlabScan struct {
+	Analyzer         gitlabScanner           `json:"analyzer"`
+	Scanner          gitlabScanner           `json:"scanner"`
+	Type             string                  `json:"type"`
+	StartTime        string                  `json:"start_time"`
+	EndTime          string                  `json:"end_time"`
+	Status           string                  `json:"status"`
+	ScannedResources []gitlabScannedResource `json:"scanned_resources,omitempty"`
+}
+
+type gitlabScanner struct {
+	ID      string       `json:"id"`
+	Name    string       `json:"name"`
+	Version string       `json:"version"`
+	Vendor  gitlabVendor `json:"vendor"`
+}
+
+type gitlabVendor struct {
+	Name string `json:"name"`
+}
+
+type gitlabScannedResource struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Type   string `json:"type"`
+}
+
+type gitlabVulnerability struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Severity    string             `json:"severity"`
+	Solution    string             `json:"solution,omitempty"`
+	Identifiers []gitlabIdentifier `json:"identifiers"`
+	Location    any                `json:"location"`
+}
+
+type gitlabIdentifier struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	URL   string `json:"url,omitempty"`
+}
+
+type gitlabSourceLocation struct {
+	File       string            `json:"file,omitempty"`
+	StartLine  int               `json:"start_line,omitempty"`
+	Commit     *gitlabCommit     `json:"commit,omitempty"`
+	Dependency *gitlabDependency `json:"dependency,omitempty"`
+}
+
+type gitlabCommit struct {
+	Sha string `json:"sha"`
+}
+
+type gitlabDependency struct {
+	Package gitlabPackage `json:"package"`
+	Version string        `json:"version"`
+}
+
+type gitlabPackage struct {
+	Name string `json:"name"`
+}
+
+type gitlabContainerLocation struct {
+	Dependency      gitlabDependency `json:"dependency"`
+	OperatingSystem string           `json:"operating_system"`
+	Image           string           `json:"image"`
+}
+
+type gitlabDastLocation struct {
+	Hostname string `json:"hostname,omitempty"`
+	Method   string `json:"method,omitempty"`
+	Param    string `json:"param,omitempty"`
+	Path     string `json:"path,omitempty"`
+}
+
+// gitlabTimeLayout is the timestamp format of the report schemas (no zone)
+const gitlabTimeLayout = "2006-01-02T15:04:05"
+
+// gitlabNoCommit is the commit sha of secrets found in a working tree rather
+// than in the git history
+const gitlabNoCommit = "0000000"
+
+// MarshalGitlabReport converts findings into a GitLab security report of the
+// given type. tools lists the scanners that produced the findings.
+func MarshalGitlabReport(reportType string, findings []Finding, tools []string, start, end time.Time) ([]byte, error) {
+	if !slices.Contains(GitlabReportTypes, reportType) {
+		return nil, fmt.Errorf("unknown GitLab report type %q", reportType)
+	}
+
+	// The reports do not record tool versions
+	scanner := gitlabScanner{
+		ID:      "devsecops",
+		Name:    "DevSecOps",
+		Version: "unknown",
+		Vendor:  gitlabVendor{Name: "DevSecOps"},
+	}
+	if len(tools) > 0 {
+		scanner.ID = strings.Join(tools, "+")
+		scanner.Name = strings.Join(tools, ", ")
+		scanner.Vendor.Name = scanner.Name
+	}
+
+	report := gitlabReport{
+		Version: GitlabSchemaVersion,
+		Scan: gitlabScan{
+			Analyzer: gitlabScanner{
+				ID:      "devsecops-dagger",
+				Name:    "DevSecOps Dagger module",
+				Version: "1.0.0",
+				Vendor:  gitlabVendor{Name: "DevSecOps"},
+			},
+			Scanner:   scanner,
+			Type:      reportType,
+			StartTime: start.UTC().Format(gitlabTimeLayout),
+			EndTime:   end.UTC().Format(gitlabTimeLayout),
+			Status:    "success",
+		},
+		Vulnerabilities: []gitlabVulnerability{},
+	}
+	if reportType == GitlabDast {
+		report.Scan.ScannedResources = []gitlabScannedResource{}
+	}
+
+	for _, f := range findings {
+		v := gitlabVulnerability{
+			ID:          f.Fingerprint,
+			Name:        firstLine(cmp.Or(f.Title, f.RuleID)),
+			Description: cmp.Or(f.Title, f.RuleID),
+			Severity:    gitlabSeverity(f.Severity),
+			Identifiers: gitlabIdentifiers(f),
+		}
+		if f.FixedVersion != "" {
+			v.Solution = fmt.Sprintf("Upgrade %s to version %s or later", f.Package, f.FixedVersion)
+		}
+
+		switch reportType {
+		case GitlabSecretDetection:
+			v.Location = gitlabSourceLocation{File: f.File, StartLine: f.Line, Commit: &gitlabCommit{Sha: gitlabNoCommit}}
+		case GitlabSast:
+			v.Location = gitlabSourceLocation{File: cmp.Or(f.File, f.Location), StartLine: f.Line}
+		case GitlabDependencyScanning:
+			v.Location = gitlabSourceLocation{
+				File:       f.File,
+				Dependency: &gitlabDependency{Package: gitlabPackage{Name: f.Package}, Version: f.Version},
+			}
+		case GitlabContainerScanning:
+			image, os := containerTarget(f.File)
+			v.Location = gitlabContainerLocation{
+				Dependency:      gitlabDependency{Package: gitlabPackage{Name: f.Package}, Version: f.Version},
+				OperatingSystem: os,
+				Image:           image,
+			}
+		case GitlabDast:
+			location, resource := dastLocation(f.Location)
+			v.Location = location
+			if resource.URL != "" && !slices.Contains(report.Scan.ScannedResources, resource) {
+				report.Scan.ScannedResources = append(report.Scan.ScannedResources, resource)
+			}
+		}
+
+		report.Vulnerabilities = append(report.Vulnerabilities, v)
+	}
+
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// gitlabSeverity maps a severity to the capitalized schema value
+func gitlabSeverity(s Severity) string {
+	if s == "" {
+		s = SeverityUnknown
+	}
+	return string(s[0]) + strings.ToLower(string(s[1:]))
+}
+
+// gitlabIdentifiers returns the rule id and aliases of a finding as report
+// identifiers, typed as CVE, GHSA or CWE when recognizable
+func gitlabIdentifiers(f Finding) []gitlabIdentifier {
+	var identifiers []gitlabIdentifier
+	for _, id := range append([]string{cmp.Or(f.RuleID, f.Tool+"/"+f.Category)}, f.Aliases...) {
+		identifier := gitlabIdentifier{Type: f.Tool + "_rule_id", Name: id, Value: id}
+		switch upper := strings.ToUpper(id); {
+		case strings.HasPrefix(upper, "CVE-"):
+			identifier.Type = "cve"
+			identifier.URL = "https://nvd.nist.gov/vuln/detail/" + id
+		case strings.HasPrefix(upper, "GHSA-"):
+			identifier.Type = "ghsa"
+			identifier.URL = "https://github.com/advisories/" + id
+		case strings.HasPrefix(upper, "CWE-"):
+			identifier.Type = "cwe"
+			identifier.Value = strings.TrimPrefix(upper, "CWE-")
+			identifier.URL = "https://cwe.mitre.org/data/definitions/" + identifier.Value + ".html"
+		}
+		identifiers = append(identifiers, identifier)
+	}
+	return identifiers
+}
+
+// containerTarget splits a Trivy image target such as
+// "app:latest (alpine 3.19.1)" into the image and its operating system
+func containerTarget(target string) (image, os string) {
+	image, os, ok := strings.Cut(target, " (")
+	if !ok {
+		return target, "unknown"
+	}
+	return image, cmp.Or(strings.TrimSuffix(os, ")"), "unknown")
+}
+
+// dastLocation splits a ZAP finding location ("GET https://host/path (param)")
+// into a report location and the scanned resource
+func dastLocation(location string) (gitlabDastLocation, gitlabScannedResource) {
+	var dast gitlabDastLocation
+	if before, param, ok := strings.Cut(location, " ("); ok {
+		location = before
+		dast.Param = strings.TrimSuffix(param, ")")
+	}
+	if method, rest, ok := strings.Cut(location, " "); ok {
+		dast.Method = method
+		location = rest
+	}
+
+	u, err := url.Parse(location)
+	if err != nil || u.Host == "" {
+		dast.Path = location
+		return dast, gitlabScannedResource{}
+	}
+	dast.Hostname = u.Scheme + "://" + u.Host
+	dast.Path = cmp.Or(u.RequestURI(), "/")
+	return dast, gitlabScannedResource{Method: cmp.Or(dast.Method, "GET"), URL: location, Type: "url"}
+}
@@ -0,0 +1,164 @@
+package findings
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalGitlabReport(t *testing.T) {
+	tests := []struct {
+		reportType string
+		reports    []string
+	}{
+		{reportType: GitlabSecretDetection, reports: []string{"gitleaks.json"}},
+		{reportType: GitlabSast, reports: []string{"semgrep.json", "polaris.json"}},
+		{reportType: GitlabDependencyScanning, reports: []string{"npm-audit-v7.json", "npm-audit-v6.json", "pip-audit.json", "composer-audit.json"}},
+		{reportType: GitlabContainerScanning, reports: []string{"trivy-image.json"}},
+		{reportType: GitlabDast, reports: []string{"zap.json"}},
+		// Clean scans produce reports without vulnerabilities
+		{reportType: GitlabDependencyScanning, reports: []string{"composer-audit-clean.json"}},
+	}
+
+	start := time.Date(2024, 11, 5, 10, 12, 31, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.reportType+"/"+strings.Join(tt.reports, "+"), func(t *testing.T) {
+			var all []Finding
+			var tools []string
+			for _, report := range tt.reports {
+				data, err := os.ReadFile(filepath.Join("testdata", report))
+				if err != nil {
+					t.Fatal(err)
+				}
+				parsed, format, err := Parse(report, data)
+				if err != nil {
+					t.Fatalf("Parse(%s) error = %v", report, err)
+				}
+				all = append(all, parsed...)
+				tools = append(tools, string(format))
+			}
+
+			data, err := MarshalGitlabReport(tt.reportType, Dedupe(all), tools, start, start.Add(time.Minute))
+			if err != nil {
+				t.Fatalf("MarshalGitlabReport() error = %v", err)
+			}
+			violations, err := ValidateGitlabReport(tt.reportType, data)
+			if err != nil {
+				t.Fatalf("ValidateGitlabReport() error = %v", err)
+			}
+			if len(violations) > 0 {
+				t.Errorf("%s does not match schema %s:\n%s\n%s", GitlabReportFile(tt.reportType),
+					GitlabSchemaVersion, strings.Join(violations, "\n"), data)
+			}
+		})
+	}
+}
+
+func TestValidateGitlabReport(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "missing scan and vulnerabilities",
+			data: `{"version": "15.2.1"}`,
+			want: []string{"scan", "vulnerabilities"},
+		},
+		{
+			name: "severity outside the enum",
+			data: `{"version": "15.2.1", "scan": {"analyzer": {"id": "a", "name": "a", "version": "1", "vendor": {"name": "a"}},
+				"scanner": {"id": "s", "name": "s", "version": "1", "vendor": {"name": "s"}},
+				"type": "secret_detection", "start_time": "2024-11-05T10:12:31", "end_time": "2024-11-05T10:13:31", "status": "success"},
+				"vulnerabilities": [{"id": "1", "severity": "Severe", "identifiers": [{"type": "gitleaks_rule_id", "name": "r", "value": "r"}],
+				"location": {"file": "a.py", "commit": {"sha": "0000000"}}}]}`,
+			want: []string{"/vulnerabilities/0/severity"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := ValidateGitlabReport(GitlabSecretDetection, []byte(tt.data))
+			if err != nil {
+				t.Fatalf("ValidateGitlabReport() error = %v", err)
+			}
+			got := strings.Join(violations, "\n")
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("violations do not mention %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+
+	if _, err := ValidateGitlabReport(GitlabSecretDetection, []byte("not json")); err == nil {
+		t.Error("ValidateGitlabReport() accepted a report that is not JSON")
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	// A draft-07 schema using the keywords of the GitLab report schemas
+	schema := `{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type": "object",
+		"required": ["version", "vulnerabilities"],
+		"properties": {
+			"version": {"type": "string", "pattern": "^[0-9]+\\.[0-9]+\\.[0-9]+$"},
+			"vulnerabilities": {"type": "array", "items": {"$ref": "#/definitions/vulnerability"}}
+		},
+		"definitions": {
+			"vulnerability": {
+				"type": "object",
+				"required": ["id", "severity"],
+				"properties": {
+					"id": {"type": "string", "minLength": 1},
+					"severity": {"type": "string", "enum": ["Info", "Unknown", "Low", "Medium", "High", "Critical"]}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "valid",
+			data: `{"version": "15.2.1", "vulnerabilities": [{"id": "1", "severity": "High"}]}`,
+		},
+		{
+			name: "missing property",
+			data: `{"version": "15.2.1"}`,
+			want: []string{": missing property 'vulnerabilities'"},
+		},
+		{
+			name: "violations through a reference",
+			data: `{"version": "15", "vulnerabilities": [{"id": "", "severity": "Severe"}]}`,
+			want: []string{"/version: ", "/vulnerabilities/0/id: ", "/vulnerabilities/0/severity: "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := validateJSON("test.json", []byte(schema), []byte(tt.data))
+			if err != nil {
+				t.Fatalf("validateJSON() error = %v", err)
+			}
+			if len(violations) != len(tt.want) {
+				t.Fatalf("validateJSON() = %q, want %d violation(s)", violations, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(violations[i], want) {
+					t.Errorf("violation %d = %q, want prefix %q", i, violations[i], want)
+				}
+			}
+		})
+	}
+
+	if _, err := validateJSON("test.json", []byte(schema), []byte("not json")); err == nil {
+		t.Error("validateJSON() accepted a document that is not JSON")
+	}
+}
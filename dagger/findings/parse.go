@@ -0,0 +1,636 @@
+package findings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Format identifies a report format
+type Format string
+
+const (
+	FormatUnknown       Format = ""
+	FormatGitleaks      Format = "gitleaks"
+	FormatTrivy         Format = "trivy"
+	FormatNpmAudit      Format = "npm-audit"
+	FormatPipAudit      Format = "pip-audit"
+	FormatComposerAudit Format = "composer-audit"
+	FormatSemgrep       Format = "semgrep"
+	FormatPolaris       Format = "polaris"
+	FormatZap           Format = "zap"
+)
+
+// Detect identifies the format of a report from its content. Report file
+// names are not reliable: dependency-scan.json is written by Trivy, npm audit,
+// pip-audit or composer audit depending on the pipeline configuration.
+func Detect(data []byte) Format {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return FormatUnknown
+	}
+
+	if data[0] == '[' {
+		var entries []map[string]json.RawMessage
+		if json.Unmarshal(data, &entries) != nil || len(entries) == 0 {
+			return FormatUnknown
+		}
+		switch {
+		case entries[0]["RuleID"] != nil:
+			return FormatGitleaks
+		case entries[0]["vulns"] != nil:
+			// pip-audit < 2.0 wrote a bare list of dependencies
+			return FormatPipAudit
+		}
+		return FormatUnknown
+	}
+
+	var top map[string]json.RawMessage
+	if json.Unmarshal(data, &top) != nil {
+		return FormatUnknown
+	}
+
+	switch {
+	case top["SchemaVersion"] != nil || top["ArtifactName"] != nil:
+		return FormatTrivy
+	case top["PolarisOutputVersion"] != nil || top["AuditTime"] != nil:
+		return FormatPolaris
+	case top["site"] != nil && (top["@programName"] != nil || top["@version"] != nil):
+		return FormatZap
+	case top["auditReportVersion"] != nil || top["vulnerabilities"] != nil:
+		return FormatNpmAudit
+	case top["advisories"] != nil && (top["actions"] != nil || top["muted"] != nil):
+		// npm audit v6 report
+		return FormatNpmAudit
+	case top["advisories"] != nil:
+		return FormatComposerAudit
+	case top["dependencies"] != nil:
+		return FormatPipAudit
+	case top["results"] != nil:
+		return FormatSemgrep
+	}
+	return FormatUnknown
+}
+
+// Empty reports whether a report is an empty JSON object or list: the "{}"
+// placeholder written when a scan is skipped, or the "[]" Gitleaks and
+// pip-audit write when they find nothing. Empty reports have no format.
+func Empty(data []byte) bool {
+	var v any
+	if json.Unmarshal(data, &v) != nil {
+		return false
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// Parse detects the format of a report and parses its findings. The report
+// name is recorded on every finding. Reports of an unknown format, including
+// empty reports, yield no findings and FormatUnknown: tell them apart with
+// Empty.
+func Parse(report string, data []byte) ([]Finding, Format, error) {
+	format := Detect(data)
+
+	var (
+		findings []Finding
+		err      error
+	)
+	switch format {
+	case FormatGitleaks:
+		findings, err = parseGitleaks(data)
+	case FormatTrivy:
+		findings, err = parseTrivy(data)
+	case FormatNpmAudit:
+		findings, err = parseNpmAudit(data)
+	case FormatPipAudit:
+		findings, err = parsePipAudit(data)
+	case FormatComposerAudit:
+		findings, err = parseComposerAudit(data)
+	case FormatSemgrep:
+		findings, err = parseSemgrep(data)
+	case FormatPolaris:
+		findings, err = parsePolaris(data)
+	case FormatZap:
+		findings, err = parseZap(data)
+	default:
+		return nil, FormatUnknown, nil
+	}
+	if err != nil {
+		return nil, format, fmt.Errorf("parse %s report %s: %w", format, report, err)
+	}
+
+	for i := range findings {
+		findings[i].Tool = string(format)
+		findings[i].Report = report
+	}
+	fingerprint(findings)
+	return findings, format, nil
+}
+
+func parseGitleaks(data []byte) ([]Finding, error) {
+	var leaks []struct {
+		RuleID      string
+		Description string
+		File        string
+		StartLine   int
+		Match       string
+	}
+	if err := json.Unmarshal(data, &leaks); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, leak := range leaks {
+		findings = append(findings, Finding{
+			Category: CategorySecret,
+			RuleID:   leak.RuleID,
+			// Gitleaks has no severity: every leaked secret is treated as high
+			Severity: SeverityHigh,
+			Title:    leak.Description,
+			File:     leak.File,
+			Line:     leak.StartLine,
+			Snippet:  leak.Match,
+		})
+	}
+	return findings, nil
+}
+
+func parseTrivy(data []byte) ([]Finding, error) {
+	var report struct {
+		Results []struct {
+			Target          string
+			Vulnerabilities []struct {
+				VulnerabilityID  string
+				PkgName          string
+				InstalledVersion string
+				FixedVersion     string
+				Severity         string
+				Title            string
+			}
+			Misconfigurations []struct {
+				ID            string
+				AVDID         string
+				Title         string
+				Severity      string
+				Status        string
+				CauseMetadata struct {
+					Resource  string
+					StartLine int
+					Code      struct {
+						Lines []struct {
+							Content string
+							IsCause bool
+						}
+					}
+				}
+			}
+			Secrets []struct {
+				RuleID    string
+				Title     string
+				Severity  string
+				StartLine int
+				// Line of the secret, with the secret redacted
+				Match string
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			findings = append(findings, Finding{
+				Category:     CategoryVulnerability,
+				RuleID:       v.VulnerabilityID,
+				Severity:     ParseSeverity(v.Severity),
+				Title:        v.Title,
+				File:         result.Target,
+				Package:      v.PkgName,
+				Version:      v.InstalledVersion,
+				FixedVersion: v.FixedVersion,
+			})
+		}
+		for _, m := range result.Misconfigurations {
+			if m.Status == "PASS" {
+				continue
+			}
+			f := Finding{
+				Category: CategoryMisconfig,
+				RuleID:   m.ID,
+				Severity: ParseSeverity(m.Severity),
+				Title:    m.Title,
+				File:     result.Target,
+				Line:     m.CauseMetadata.StartLine,
+				Snippet:  m.CauseMetadata.Resource,
+			}
+			for _, line := range m.CauseMetadata.Code.Lines {
+				if line.IsCause {
+					f.Snippet += "\n" + line.Content
+				}
+			}
+			if m.AVDID != "" && m.AVDID != m.ID {
+				f.Aliases = []string{m.AVDID}
+			}
+			findings = append(findings, f)
+		}
+		for _, s := range result.Secrets {
+			findings = append(findings, Finding{
+				Category: CategorySecret,
+				RuleID:   s.RuleID,
+				Severity: ParseSeverity(s.Severity),
+				Title:    s.Title,
+				File:     result.Target,
+				Line:     s.StartLine,
+				Snippet:  s.Match,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func parseNpmAudit(data []byte) ([]Finding, error) {
+	var report struct {
+		// npm 7+ (auditReportVersion 2)
+		Vulnerabilities map[string]struct {
+			Name         string
+			Via          []json.RawMessage
+			FixAvailable json.RawMessage
+		} `json:"vulnerabilities"`
+		// npm 6
+		Advisories map[string]struct {
+			ID              int    `json:"id"`
+			ModuleName      string `json:"module_name"`
+			Severity        string `json:"severity"`
+			Title           string `json:"title"`
+			URL             string `json:"url"`
+			PatchedVersions string `json:"patched_versions"`
+			CVEs            []string
+			Findings        []struct {
+				Version string
+			}
+		} `json:"advisories"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for name, vuln := range report.Vulnerabilities {
+		fixed := ""
+		var fix struct {
+			Name    string
+			Version string
+		}
+		if json.Unmarshal(vuln.FixAvailable, &fix) == nil && fix.Name == name {
+			fixed = fix.Version
+		}
+
+		for _, raw := range vuln.Via {
+			// String entries point at another vulnerable package (a transitive
+			// effect); the advisory itself is reported on that package.
+			var via struct {
+				Source   int
+				Name     string
+				Title    string
+				URL      string
+				Severity string
+				Range    string
+			}
+			if json.Unmarshal(raw, &via) != nil || via.Source == 0 {
+				continue
+			}
+			findings = append(findings, Finding{
+				Category:     CategoryVulnerability,
+				RuleID:       advisoryID(via.URL, fmt.Sprintf("npm-%d", via.Source)),
+				Severity:     ParseSeverity(via.Severity),
+				Title:        via.Title,
+				File:         "package-lock.json",
+				Package:      via.Name,
+				FixedVersion: fixed,
+			})
+		}
+	}
+
+	for _, adv := range report.Advisories {
+		f := Finding{
+			Category:     CategoryVulnerability,
+			RuleID:       advisoryID(adv.URL, fmt.Sprintf("npm-%d", adv.ID)),
+			Severity:     ParseSeverity(adv.Severity),
+			Title:        adv.Title,
+			File:         "package-lock.json",
+			Package:      adv.ModuleName,
+			FixedVersion: adv.PatchedVersions,
+		}
+		for _, cve := range adv.CVEs {
+			if cve != f.RuleID {
+				f.Aliases = append(f.Aliases, cve)
+			}
+		}
+		if len(adv.Findings) == 0 {
+			findings = append(findings, f)
+		}
+		for _, installed := range adv.Findings {
+			f.Version = installed.Version
+			findings = append(findings, f)
+		}
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+// advisoryID extracts a GHSA identifier from an advisory URL, falling back to
+// the given identifier.
+func advisoryID(url, fallback string) string {
+	if id := path.Base(url); strings.HasPrefix(id, "GHSA-") {
+		return id
+	}
+	return fallback
+}
+
+func parsePipAudit(data []byte) ([]Finding, error) {
+	type dependency struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Vulns   []struct {
+			ID          string   `json:"id"`
+			FixVersions []string `json:"fix_versions"`
+			Aliases     []string `json:"aliases"`
+			Description string   `json:"description"`
+		} `json:"vulns"`
+	}
+
+	var deps []dependency
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &deps); err != nil {
+			return nil, err
+		}
+	} else {
+		var report struct {
+			Dependencies []dependency `json:"dependencies"`
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, err
+		}
+		deps = report.Dependencies
+	}
+
+	var findings []Finding
+	for _, dep := range deps {
+		for _, vuln := range dep.Vulns {
+			f := Finding{
+				Category: CategoryVulnerability,
+				RuleID:   vuln.ID,
+				Aliases:  vuln.Aliases,
+				// pip-audit does not report severities
+				Severity: SeverityUnknown,
+				Title:    firstLine(vuln.Description),
+				File:     "requirements.txt",
+				Package:  dep.Name,
+				Version:  dep.Version,
+			}
+			if len(vuln.FixVersions) > 0 {
+				f.FixedVersion = vuln.FixVersions[0]
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings, nil
+}
+
+func parseComposerAudit(data []byte) ([]Finding, error) {
+	var report struct {
+		// An empty PHP array is encoded as [] rather than {}
+		Advisories json.RawMessage `json:"advisories"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	var advisories map[string][]struct {
+		AdvisoryID       string `json:"advisoryId"`
+		PackageName      string `json:"packageName"`
+		AffectedVersions string `json:"affectedVersions"`
+		Title            string `json:"title"`
+		CVE              string `json:"cve"`
+		Severity         string `json:"severity"`
+	}
+	if string(bytes.TrimSpace(report.Advisories)) == "[]" {
+		return nil, nil
+	}
+	if err := json.Unmarshal(report.Advisories, &advisories); err != nil {
+		return nil, fmt.Errorf("unexpected composer audit advisories: %w", err)
+	}
+
+	var findings []Finding
+	for pkg, list := range advisories {
+		for _, adv := range list {
+			f := Finding{
+				Category: CategoryVulnerability,
+				RuleID:   adv.AdvisoryID,
+				Severity: ParseSeverity(adv.Severity),
+				Title:    adv.Title,
+				File:     "composer.lock",
+				Package:  pkg,
+			}
+			if adv.CVE != "" {
+				f.RuleID = adv.CVE
+				f.Aliases = []string{adv.AdvisoryID}
+			}
+			findings = append(findings, f)
+		}
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+func parseSemgrep(data []byte) ([]Finding, error) {
+	var report struct {
+		Results []struct {
+			CheckID string `json:"check_id"`
+			Path    string `json:"path"`
+			Start   struct {
+				Line int `json:"line"`
+			} `json:"start"`
+			Extra struct {
+				Message  string `json:"message"`
+				Severity string `json:"severity"`
+				Lines    string `json:"lines"`
+			} `json:"extra"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, result := range report.Results {
+		f := Finding{
+			Category: CategorySast,
+			RuleID:   result.CheckID,
+			// Semgrep severities are ERROR, WARNING and INFO
+			Severity: ParseSeverity(result.Extra.Severity),
+			Title:    firstLine(result.Extra.Message),
+			File:     result.Path,
+			Line:     result.Start.Line,
+		}
+		// Semgrep withholds the matched lines from logged-out runs
+		if result.Extra.Lines != "requires login" {
+			f.Snippet = result.Extra.Lines
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+type polarisCheck struct {
+	ID       string
+	Message  string
+	Success  bool
+	Severity string
+}
+
+func parsePolaris(data []byte) ([]Finding, error) {
+	var report struct {
+		Results []struct {
+			Name      string
+			Namespace string
+			Kind      string
+			Results   map[string]polarisCheck
+			PodResult *struct {
+				Results          map[string]polarisCheck
+				ContainerResults []struct {
+					Name    string
+					Results map[string]polarisCheck
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	add := func(location string, checks map[string]polarisCheck) {
+		for id, check := range checks {
+			// "ignore" severity checks are informational in Polaris
+			if check.Success || check.Severity == "ignore" {
+				continue
+			}
+			if check.ID != "" {
+				id = check.ID
+			}
+			findings = append(findings, Finding{
+				Category: CategoryMisconfig,
+				RuleID:   id,
+				Severity: ParseSeverity(check.Severity),
+				Title:    check.Message,
+				Location: location,
+			})
+		}
+	}
+
+	for _, res := range report.Results {
+		location := res.Kind + "/" + res.Name
+		if res.Namespace != "" {
+			location = res.Kind + "/" + res.Namespace + "/" + res.Name
+		}
+		add(location, res.Results)
+		if res.PodResult != nil {
+			add(location, res.PodResult.Results)
+			for _, c := range res.PodResult.ContainerResults {
+				add(location+"/"+c.Name, c.Results)
+			}
+		}
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+func parseZap(data []byte) ([]Finding, error) {
+	var report struct {
+		Site []struct {
+			Name   string `json:"@name"`
+			Alerts []struct {
+				PluginID  string `json:"pluginid"`
+				Name      string `json:"name"`
+				Alert     string `json:"alert"`
+				RiskCode  string `json:"riskcode"`
+				CWEID     string `json:"cweid"`
+				Instances []struct {
+					URI    string `json:"uri"`
+					Method string `json:"method"`
+					Param  string `json:"param"`
+				} `json:"instances"`
+			} `json:"alerts"`
+		} `json:"site"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, site := range report.Site {
+		for _, alert := range site.Alerts {
+			f := Finding{
+				Category: CategoryDast,
+				RuleID:   alert.PluginID,
+				Severity: zapRisk(alert.RiskCode),
+				Title:    alert.Name,
+				Location: site.Name,
+			}
+			if f.Title == "" {
+				f.Title = alert.Alert
+			}
+			if alert.CWEID != "" && alert.CWEID != "-1" && alert.CWEID != "0" {
+				f.Aliases = []string{"CWE-" + alert.CWEID}
+			}
+			if len(alert.Instances) == 0 {
+				findings = append(findings, f)
+			}
+			for _, instance := range alert.Instances {
+				f.Location = strings.TrimSpace(instance.Method + " " + instance.URI)
+				if instance.Param != "" {
+					f.Location += " (" + instance.Param + ")"
+				}
+				findings = append(findings, f)
+			}
+		}
+	}
+	return findings, nil
+}
+
+// zapRisk maps a ZAP risk code to a Severity
+func zapRisk(code string) Severity {
+	switch code {
+	case "3":
+		return SeverityHigh
+	case "2":
+		return SeverityMedium
+	case "1":
+		return SeverityLow
+	case "0":
+		return SeverityInfo
+	default:
+		return SeverityUnknown
+	}
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[:i])
+	}
+	return s
+}
@@ -0,0 +1,233 @@
+package findings
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// describe formats a finding with its category and aliases for comparison
+func describe(f Finding) string {
+	s := f.Category + " " + f.String()
+	if len(f.Aliases) > 0 {
+		s += " aka " + strings.Join(f.Aliases, ",")
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		report string
+		format Format
+		want   []string
+	}{
+		{
+			report: "gitleaks.json",
+			format: FormatGitleaks,
+			want: []string{
+				"secret [HIGH] aws-access-token config/settings.py:3 - AWS Access Key",
+				"secret [HIGH] generic-api-key deploy/values.yaml:8 - Generic API Key",
+			},
+		},
+		{
+			report: "trivy-fs.json",
+			format: FormatTrivy,
+			want: []string{
+				"vulnerability [MEDIUM] CVE-2024-29041 express@4.18.2 - express: cause malformed URLs to be evaluated (fixed in 4.19.2, 5.0.0-beta.3)",
+				"vulnerability [HIGH] CVE-2024-45590 body-parser@1.20.1 - body-parser: Denial of Service Vulnerability in body-parser (fixed in 1.20.3)",
+				"misconfig [MEDIUM] KSV001 k8s/deployment.yaml:17 - Can elevate its own privileges aka AVD-KSV-0001",
+				"secret [CRITICAL] github-pat .env:2 - GitHub Personal Access Token",
+			},
+		},
+		{
+			report: "trivy-image.json",
+			format: FormatTrivy,
+			want: []string{
+				"vulnerability [LOW] CVE-2024-2511 libssl3@3.1.4-r5 - openssl: Unbounded memory growth with session handling in TLSv1.3 (fixed in 3.1.4-r6)",
+				"vulnerability [HIGH] CVE-2024-45590 body-parser@1.20.1 - body-parser: Denial of Service Vulnerability in body-parser (fixed in 1.20.3)",
+			},
+		},
+		{
+			// Packages only affected through another package are not reported
+			report: "npm-audit-v7.json",
+			format: FormatNpmAudit,
+			want: []string{
+				"vulnerability [LOW] GHSA-qw6h-vgh9-j6wx express - express vulnerable to XSS via response.redirect() (fixed in 4.21.2)",
+				"vulnerability [HIGH] GHSA-hrpp-h998-j3pp qs - qs vulnerable to Prototype Pollution",
+			},
+		},
+		{
+			report: "npm-audit-v6.json",
+			format: FormatNpmAudit,
+			want: []string{
+				"vulnerability [HIGH] GHSA-p6mc-m468-83gw lodash@4.17.15 - Prototype Pollution in lodash (fixed in >=4.17.19) aka CVE-2020-8203",
+				"vulnerability [LOW] npm-1179 minimist@0.0.8 - Prototype Pollution (fixed in >=0.2.1 <1.0.0 || >=1.2.3) aka CVE-2020-7598",
+			},
+		},
+		{
+			// pnpm audit reports in the npm 6 format
+			report: "pnpm-audit.json",
+			format: FormatNpmAudit,
+			want: []string{
+				"vulnerability [MEDIUM] GHSA-c2qf-rxjj-qqgw semver@7.5.1 - semver vulnerable to Regular Expression Denial of Service (fixed in >=7.5.2) aka CVE-2022-25883",
+			},
+		},
+		{
+			report: "pip-audit.json",
+			format: FormatPipAudit,
+			want: []string{
+				"vulnerability [UNKNOWN] PYSEC-2019-179 flask@0.5 - The Pallets Project Flask before 1.0 is affected by: unexpected memory usage. The impact is: denial of service. The attack vector is: crafted encoded JSON data. (fixed in 1.0) aka CVE-2019-1010083,GHSA-5wv5-4vpf-pj6m",
+			},
+		},
+		{
+			// pip-audit < 2.0 wrote a bare list of dependencies
+			report: "pip-audit-v1.json",
+			format: FormatPipAudit,
+			want: []string{
+				"vulnerability [UNKNOWN] PYSEC-2019-179 flask@0.5 (fixed in 1.0)",
+				"vulnerability [UNKNOWN] PYSEC-2021-66 jinja2@2.11.2 (fixed in 2.11.3)",
+			},
+		},
+		{
+			report: "composer-audit.json",
+			format: FormatComposerAudit,
+			want: []string{
+				"vulnerability [HIGH] PKSA-5kqx-5t1t-tbcb guzzlehttp/psr7 - Improper header validation",
+				"vulnerability [MEDIUM] CVE-2022-24894 symfony/http-kernel - CVE-2022-24894: Prevent storing cookie headers in HttpCache aka PKSA-2b4m-h4ts-ddtv",
+			},
+		},
+		{
+			// Composer encodes the empty advisories map as a list
+			report: "composer-audit-clean.json",
+			format: FormatComposerAudit,
+		},
+		{
+			report: "semgrep.json",
+			format: FormatSemgrep,
+			want: []string{
+				"sast [MEDIUM] javascript.express.security.audit.xss.direct-response-write.direct-response-write src/app.js:12 - Detected directly writing to a Response object from user-defined input. This bypasses any HTML escaping and may expose your application to a Cross-Site-scripting (XSS) vulnerability.",
+				"sast [HIGH] javascript.sequelize.security.audit.sequelize-injection-express.express-sequelize-injection src/db.js:7 - Detected a sequelize statement that is tainted by user-input.",
+			},
+		},
+		{
+			report: "polaris.json",
+			format: FormatPolaris,
+			want: []string{
+				"misconfig [MEDIUM] cpuLimitsMissing Deployment/shop/web/web - CPU limits should be set",
+				"misconfig [HIGH] runAsRootAllowed Deployment/shop/web/web - Should not be allowed to run as root",
+			},
+		},
+		{
+			report: "zap.json",
+			format: FormatZap,
+			want: []string{
+				"dast [MEDIUM] 10038 GET http://app:3000/ - Content Security Policy (CSP) Header Not Set aka CWE-693",
+				"dast [MEDIUM] 10038 GET http://app:3000/login - Content Security Policy (CSP) Header Not Set aka CWE-693",
+				"dast [LOW] 10010 POST http://app:3000/login (session) - Cookie No HttpOnly Flag aka CWE-1004",
+			},
+		},
+		{
+			report: "npm-audit-error.json",
+			format: FormatUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.report, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.report))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, format, err := Parse(tt.report, data)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if format != tt.format {
+				t.Errorf("Parse() format = %q, want %q", format, tt.format)
+			}
+
+			var got []string
+			fingerprints := map[string]bool{}
+			for _, f := range parsed {
+				got = append(got, describe(f))
+				if f.Tool != string(tt.format) || f.Report != tt.report {
+					t.Errorf("%s: tool %q and report %q, want %q and %q", f, f.Tool, f.Report, tt.format, tt.report)
+				}
+				if f.Fingerprint == "" || fingerprints[f.Fingerprint] {
+					t.Errorf("%s: missing or duplicate fingerprint %q", f, f.Fingerprint)
+				}
+				fingerprints[f.Fingerprint] = true
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Parse() findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseSnippets(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "semgrep.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := Parse("semgrep.json", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Logged-out runs withhold the matched lines
+	want := []string{"", "  return db.query(`SELECT * FROM users WHERE id = ${req.params.id}`);"}
+	for i, f := range parsed {
+		if f.Snippet != want[i] {
+			t.Errorf("finding %d snippet = %q, want %q", i, f.Snippet, want[i])
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{data: "{}", want: true},
+		{data: "[]\n", want: true},
+		{data: " { } ", want: true},
+		{data: "", want: false},
+		{data: "null", want: false},
+		{data: `{"results": []}`, want: false},
+		{data: `{"error": {"code": "ENOLOCK"}}`, want: false},
+		{data: "Error: no lock file", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := Empty([]byte(tt.data)); got != tt.want {
+			t.Errorf("Empty(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+		if got := Detect([]byte(tt.data)); tt.want && got != FormatUnknown {
+			t.Errorf("Detect(%q) = %q, want no format", tt.data, got)
+		}
+	}
+}
+
+func TestParseUnexpected(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "composer advisories list", data: `{"advisories": [{"advisoryId": "PKSA-5kqx-5t1t-tbcb"}]}`},
+		{name: "composer advisory object", data: `{"advisories": {"guzzlehttp/psr7": {"advisoryId": "PKSA-5kqx-5t1t-tbcb"}}}`},
+		{name: "composer advisories string", data: `{"advisories": "none"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, format, err := Parse("dependency-scan.json", []byte(tt.data))
+			if err == nil {
+				t.Errorf("Parse() = %d finding(s) as %q, want an error", len(parsed), format)
+			}
+		})
+	}
+}
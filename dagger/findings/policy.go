@@ -0,0 +1,154 @@
+package findings
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Policy modes, mirroring DEVSECOPS_SECURITY_POLICY
+const (
+	PolicyStrict     = "strict"
+	PolicyPermissive = "permissive"
+)
+
+// Policy decides which findings fail a scan
+type Policy struct {
+	// strict fails on violations, permissive only reports them
+	Mode string
+	// Minimum severity of a violation
+	MinSeverity Severity
+	// Per-scanner thresholds keyed by scan name or tool; a nil entry disables
+	// gating for that scanner
+	Overrides map[string]*Severity
+}
+
+// ParsePolicy builds a policy from its textual configuration. severity is a
+// single level ("HIGH") or a DEVSECOPS_TRIVY_SEVERITY-style list
+// ("CRITICAL,HIGH"), in which case the lowest listed level is the minimum.
+// Overrides have the form "<scanner>=<severity>" or "<scanner>=off".
+func ParsePolicy(mode, severity string, overrides []string) (*Policy, error) {
+	p := &Policy{
+		Mode:      strings.ToLower(strings.TrimSpace(mode)),
+		Overrides: map[string]*Severity{},
+	}
+	if p.Mode == "" {
+		p.Mode = PolicyStrict
+	}
+	if p.Mode != PolicyStrict && p.Mode != PolicyPermissive {
+		return nil, fmt.Errorf("unknown security policy %q (expected %q or %q)", mode, PolicyStrict, PolicyPermissive)
+	}
+
+	minSeverity, err := parseThreshold(severity)
+	if err != nil {
+		return nil, err
+	}
+	p.MinSeverity = minSeverity
+
+	for _, override := range overrides {
+		scanner, value, ok := strings.Cut(override, "=")
+		scanner = strings.TrimSpace(scanner)
+		if !ok || scanner == "" {
+			return nil, fmt.Errorf("invalid scanner policy %q (expected <scanner>=<severity|off>)", override)
+		}
+		if strings.EqualFold(strings.TrimSpace(value), "off") {
+			p.Overrides[scanner] = nil
+			continue
+		}
+		threshold, err := parseThreshold(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scanner policy %q: %w", override, err)
+		}
+		p.Overrides[scanner] = &threshold
+	}
+
+	return p, nil
+}
+
+// parseThreshold returns the lowest level of a severity list. UNKNOWN, the
+// lowest level of DEVSECOPS_TRIVY_SEVERITY, makes every finding a violation.
+func parseThreshold(value string) (Severity, error) {
+	var threshold Severity
+	for _, level := range strings.Split(value, ",") {
+		level = strings.TrimSpace(level)
+		if level == "" {
+			continue
+		}
+		severity := ParseSeverity(level)
+		if severity == SeverityUnknown && !strings.EqualFold(level, string(SeverityUnknown)) {
+			return "", fmt.Errorf("unknown severity %q", level)
+		}
+		if threshold == "" || severity.Rank() < threshold.Rank() {
+			threshold = severity
+		}
+	}
+	if threshold == "" {
+		return "", fmt.Errorf("no severity given")
+	}
+	return threshold, nil
+}
+
+// Strict reports whether violations fail the scan
+func (p *Policy) Strict() bool {
+	return p.Mode == PolicyStrict
+}
+
+// Threshold returns the minimum failing severity for a scanner, looked up by
+// scan name first and tool second. ok is false when gating is disabled.
+func (p *Policy) Threshold(scanner, tool string) (threshold Severity, ok bool) {
+	for _, key := range []string{scanner, tool} {
+		if override, found := p.Overrides[key]; found {
+			if override == nil {
+				return "", false
+			}
+			return *override, true
+		}
+	}
+	return p.MinSeverity, true
+}
+
+// Violations returns the findings at or above the scanner threshold.
+// Findings without a severity (e.g. pip-audit) cannot be ranked and always
+// count as violations.
+func (p *Policy) Violations(scanner, tool string, findings []Finding) []Finding {
+	threshold, ok := p.Threshold(scanner, tool)
+	if !ok {
+		return nil
+	}
+
+	var violations []Finding
+	for _, f := range findings {
+		if f.Severity == SeverityUnknown || f.Severity.Rank() >= threshold.Rank() {
+			violations = append(violations, f)
+		}
+	}
+	return violations
+}
+
+// Where describes the location of a finding
+func (f Finding) Where() string {
+	switch {
+	case f.Package != "" && f.Version != "":
+		return f.Package + "@" + f.Version
+	case f.Package != "":
+		return f.Package
+	case f.File != "" && f.Line > 0:
+		return f.File + ":" + strconv.Itoa(f.Line)
+	case f.File != "":
+		return f.File
+	default:
+		return f.Location
+	}
+}
+
+// String formats a finding on a single line
+func (f Finding) String() string {
+	s := fmt.Sprintf("[%s] %s %s", f.Severity, f.RuleID, f.Where())
+	if f.Title != "" {
+		s += " - " + f.Title
+	}
+	if f.FixedVersion != "" {
+		s += " (fixed in " + f.FixedVersion + ")"
+	}
+	return s
+}
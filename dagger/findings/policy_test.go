@@ -0,0 +1,117 @@
+package findings
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		severity  string
+		overrides []string
+		want      string
+		wantErr   string
+	}{
+		{name: "default mode", severity: "HIGH", want: "strict HIGH"},
+		{name: "mode case", mode: " Permissive ", severity: "high", want: "permissive HIGH"},
+		{name: "severity list", severity: "CRITICAL,HIGH", want: "strict HIGH"},
+		{name: "unordered list", severity: "LOW, CRITICAL ,MEDIUM", want: "strict LOW"},
+		{name: "unknown in list", severity: "CRITICAL,HIGH,MEDIUM,LOW,UNKNOWN", want: "strict UNKNOWN"},
+		{name: "tool labels", severity: "moderate", want: "strict MEDIUM"},
+		{
+			name:      "overrides",
+			severity:  "HIGH",
+			overrides: []string{"secrets=LOW", "dependencies=off", "semgrep = CRITICAL,HIGH", "trivy=OFF"},
+			want:      "strict HIGH dependencies=off secrets=LOW semgrep=HIGH trivy=off",
+		},
+		{name: "unknown mode", mode: "lenient", severity: "HIGH", wantErr: `unknown security policy "lenient"`},
+		{name: "unknown severity", severity: "SEVERE", wantErr: `unknown severity "SEVERE"`},
+		{name: "no severity", severity: " , ", wantErr: "no severity given"},
+		{name: "override without scanner", severity: "HIGH", overrides: []string{"=LOW"}, wantErr: "invalid scanner policy"},
+		{name: "override without severity", severity: "HIGH", overrides: []string{"secrets"}, wantErr: "invalid scanner policy"},
+		{name: "override with unknown severity", severity: "HIGH", overrides: []string{"secrets=SEVERE"}, wantErr: `unknown severity "SEVERE"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePolicy(tt.mode, tt.severity, tt.overrides)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParsePolicy() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePolicy() error = %v", err)
+			}
+
+			got := []string{p.Mode, string(p.MinSeverity)}
+			for _, scanner := range []string{"dependencies", "secrets", "semgrep", "trivy"} {
+				override, ok := p.Overrides[scanner]
+				switch {
+				case !ok:
+				case override == nil:
+					got = append(got, scanner+"=off")
+				default:
+					got = append(got, scanner+"="+string(*override))
+				}
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("ParsePolicy() = %q, want %q", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestViolations(t *testing.T) {
+	scanned := []Finding{
+		{RuleID: "critical", Severity: SeverityCritical},
+		{RuleID: "high", Severity: SeverityHigh},
+		{RuleID: "medium", Severity: SeverityMedium},
+		{RuleID: "low", Severity: SeverityLow},
+		{RuleID: "info", Severity: SeverityInfo},
+		{RuleID: "unknown", Severity: SeverityUnknown},
+	}
+
+	policy, err := ParsePolicy(PolicyStrict, "HIGH", []string{
+		"secrets=LOW",
+		"trivy=CRITICAL",
+		"dependencies=off",
+		"pip-audit=INFO",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		scanner string
+		tool    string
+		want    string
+	}{
+		{name: "default threshold", scanner: "sast", tool: "semgrep", want: "critical high unknown"},
+		{name: "scan override", scanner: "secrets", tool: "gitleaks", want: "critical high medium low unknown"},
+		{name: "tool override", scanner: "sast", tool: "trivy", want: "critical unknown"},
+		{name: "scan before tool", scanner: "secrets", tool: "trivy", want: "critical high medium low unknown"},
+		{name: "scan off before tool", scanner: "dependencies", tool: "pip-audit"},
+		{name: "tool without scan override", scanner: "deps", tool: "pip-audit", want: "critical high medium low info unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range policy.Violations(tt.scanner, tt.tool, scanned) {
+				got = append(got, f.RuleID)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("Violations(%s, %s) = %q, want %q", tt.scanner, tt.tool, strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+
+	if threshold, ok := policy.Threshold("dependencies", "npm-audit"); ok {
+		t.Errorf("Threshold(dependencies) = %s, want gating disabled", threshold)
+	}
+}
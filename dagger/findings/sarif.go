@@ -0,0 +1,268 @@
+package findings
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// SARIF 2.1.0 schema and version
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+)
+
+// sarifFingerprintKey names the partial fingerprint carrying Finding.Fingerprint
+const sarifFingerprintKey = "devsecopsFingerprint/v1"
+
+// Tool metadata shown by SARIF viewers
+var sarifTools = map[string]struct{ name, uri string }{
+	"gitleaks":       {"Gitleaks", "https://github.com/gitleaks/gitleaks"},
+	"trivy":          {"Trivy", "https://trivy.dev"},
+	"npm-audit":      {"npm audit", "https://docs.npmjs.com/cli/commands/npm-audit"},
+	"pip-audit":      {"pip-audit", "https://github.com/pypa/pip-audit"},
+	"composer-audit": {"composer audit", "https://getcomposer.org/doc/03-cli.md#audit"},
+	"semgrep":        {"Semgrep", "https://semgrep.dev"},
+	"polaris":        {"Polaris", "https://www.fairwinds.com/polaris"},
+	"zap":            {"OWASP ZAP", "https://www.zaproxy.org"},
+}
+
+// sarifLog is a SARIF 2.1.0 log. Only the properties filled in by toSarif
+// are modelled.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRun holds the results of one tool
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string          `json:"id"`
+	ShortDescription *sarifMessage   `json:"shortDescription,omitempty"`
+	DefaultConfig    sarifRuleConfig `json:"defaultConfiguration"`
+	Properties       sarifProperties `json:"properties"`
+}
+
+type sarifRuleConfig struct {
+	Level string `json:"level"`
+}
+
+// sarifProperties carries the GitHub code scanning severity of a rule
+type sarifProperties struct {
+	Tags             []string `json:"tags,omitempty"`
+	SecuritySeverity string   `json:"security-severity"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations,omitempty"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+	Kind               string `json:"kind,omitempty"`
+}
+
+// sarifLevel maps a severity to a SARIF result level
+func sarifLevel(s Severity) string {
+	switch s {
+	case SeverityCritical, SeverityHigh:
+		return "error"
+	case SeverityLow, SeverityInfo:
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+// sarifSecuritySeverity maps a severity to the CVSS-like score GitHub code
+// scanning uses to rank security alerts
+func sarifSecuritySeverity(s Severity) string {
+	switch s {
+	case SeverityCritical:
+		return "9.5"
+	case SeverityHigh:
+		return "8.0"
+	case SeverityMedium:
+		return "5.5"
+	case SeverityLow:
+		return "3.0"
+	case SeverityInfo:
+		return "0.0"
+	default:
+		// Unranked findings (e.g. pip-audit) are surfaced as medium
+		return "5.5"
+	}
+}
+
+// toSarif converts findings into a SARIF log with one run per tool, in order
+// of first appearance. Rules are keyed by rule id and take the highest
+// severity reported for them.
+func toSarif(findings []Finding) *sarifLog {
+	log := &sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{}}
+
+	runs := map[string]int{}
+	rules := map[string]map[string]int{}
+	ruleSeverity := map[string]map[string]Severity{}
+
+	for _, f := range findings {
+		i, ok := runs[f.Tool]
+		if !ok {
+			tool := sarifTools[f.Tool]
+			if tool.name == "" {
+				tool.name = f.Tool
+			}
+			log.Runs = append(log.Runs, sarifRun{
+				Tool:    sarifTool{Driver: sarifDriver{Name: tool.name, InformationURI: tool.uri, Rules: []sarifRule{}}},
+				Results: []sarifResult{},
+			})
+			i = len(log.Runs) - 1
+			runs[f.Tool] = i
+			rules[f.Tool] = map[string]int{}
+			ruleSeverity[f.Tool] = map[string]Severity{}
+		}
+		run := &log.Runs[i]
+
+		ruleID := f.RuleID
+		if ruleID == "" {
+			ruleID = f.Tool + "/" + f.Category
+		}
+
+		ruleIndex, ok := rules[f.Tool][ruleID]
+		if !ok {
+			rule := sarifRule{
+				ID:         ruleID,
+				Properties: sarifProperties{Tags: []string{"security", f.Category}},
+			}
+			if f.Title != "" {
+				rule.ShortDescription = &sarifMessage{Text: firstLine(f.Title)}
+			}
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+			ruleIndex = len(run.Tool.Driver.Rules) - 1
+			rules[f.Tool][ruleID] = ruleIndex
+		}
+		if current, ok := ruleSeverity[f.Tool][ruleID]; !ok || f.Severity.Rank() > current.Rank() {
+			ruleSeverity[f.Tool][ruleID] = f.Severity
+			rule := &run.Tool.Driver.Rules[ruleIndex]
+			rule.DefaultConfig.Level = sarifLevel(f.Severity)
+			rule.Properties.SecuritySeverity = sarifSecuritySeverity(f.Severity)
+		}
+
+		run.Results = append(run.Results, sarifResult{
+			RuleID:              ruleID,
+			RuleIndex:           ruleIndex,
+			Level:               sarifLevel(f.Severity),
+			Message:             sarifMessage{Text: sarifText(f)},
+			Locations:           sarifLocations(f),
+			PartialFingerprints: map[string]string{sarifFingerprintKey: f.Fingerprint},
+		})
+	}
+
+	return log
+}
+
+// MarshalSarif converts findings into an indented SARIF 2.1.0 document with
+// one run per tool
+func MarshalSarif(findings []Finding) ([]byte, error) {
+	return json.MarshalIndent(toSarif(findings), "", "  ")
+}
+
+// sarifText describes a result: its title, affected package and fix
+func sarifText(f Finding) string {
+	parts := []string{cmp.Or(f.Title, f.RuleID)}
+	if f.Package != "" {
+		parts = append(parts, "in "+f.Where())
+	} else if f.Location != "" {
+		parts = append(parts, "at "+f.Location)
+	}
+	if f.FixedVersion != "" {
+		parts = append(parts, "(fixed in "+f.FixedVersion+")")
+	}
+	if len(f.AlsoReportedBy) > 0 {
+		parts = append(parts, "[also reported by "+strings.Join(f.AlsoReportedBy, ", ")+"]")
+	}
+	return strings.Join(slices.DeleteFunc(parts, func(s string) bool { return s == "" }), " ")
+}
+
+// sarifLocations returns the file location of a finding, and a logical
+// location for images, packages, URLs and Kubernetes objects. GitHub code
+// scanning requires a file location: findings without a file (ZAP alerts,
+// Polaris objects, the operating system packages of an image) are located in
+// the report they were read from.
+func sarifLocations(f Finding) []sarifLocation {
+	var location sarifLocation
+	file := f.File
+	if image, _, ok := strings.Cut(file, " ("); ok {
+		// Trivy targets such as "app:latest (alpine 3.19.1)" name an image
+		location.LogicalLocations = []sarifLogicalLocation{{Name: image, FullyQualifiedName: file, Kind: "module"}}
+		file = ""
+	}
+	if file := cmp.Or(file, f.Report); file != "" {
+		location.PhysicalLocation = &sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: sarifURI(file)},
+		}
+		if f.Line > 0 && file == f.File {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line}
+		}
+	}
+	switch {
+	case f.Package != "":
+		location.LogicalLocations = append(location.LogicalLocations, sarifLogicalLocation{Name: f.Package, FullyQualifiedName: f.Where(), Kind: "package"})
+	case f.Location != "":
+		location.LogicalLocations = append(location.LogicalLocations, sarifLogicalLocation{Name: f.Location, Kind: "resource"})
+	}
+	if location.PhysicalLocation == nil && location.LogicalLocations == nil {
+		return nil
+	}
+	return []sarifLocation{location}
+}
+
+// sarifURI converts a relative file path into a relative URI reference,
+// escaping the characters URIs do not allow
+func sarifURI(file string) string {
+	return (&url.URL{Path: strings.TrimPrefix(file, "./")}).EscapedPath()
+}
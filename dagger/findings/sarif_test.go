@@ -0,0 +1,127 @@
+package findings
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// describeLocations formats the SARIF locations of a result for comparison
+func describeLocations(locations []sarifLocation) string {
+	var parts []string
+	for _, l := range locations {
+		if p := l.PhysicalLocation; p != nil {
+			part := p.ArtifactLocation.URI
+			if p.Region != nil {
+				part += fmt.Sprintf(":%d", p.Region.StartLine)
+			}
+			parts = append(parts, part)
+		}
+		for _, logical := range l.LogicalLocations {
+			parts = append(parts, logical.Kind+" "+cmp.Or(logical.FullyQualifiedName, logical.Name))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestSarifLocations(t *testing.T) {
+	tests := []struct {
+		name    string
+		finding Finding
+		want    string
+	}{
+		{
+			name:    "file and line",
+			finding: Finding{File: "./src/app.js", Line: 12, Report: "semgrep.json"},
+			want:    "src/app.js:12",
+		},
+		{
+			name:    "file to escape",
+			finding: Finding{File: "docs/my notes#1.md", Line: 3},
+			want:    "docs/my%20notes%231.md:3",
+		},
+		{
+			name:    "package in a lock file",
+			finding: Finding{File: "package-lock.json", Package: "qs", Version: "6.5.2"},
+			want:    "package-lock.json package qs@6.5.2",
+		},
+		{
+			name:    "image operating system package",
+			finding: Finding{File: "app:latest (alpine 3.19.1)", Package: "libssl3", Version: "3.1.4-r5", Report: "trivy.json"},
+			want:    "trivy.json module app:latest (alpine 3.19.1) package libssl3@3.1.4-r5",
+		},
+		{
+			name:    "image without report",
+			finding: Finding{File: "app:latest (alpine 3.19.1)", Package: "libssl3"},
+			want:    "module app:latest (alpine 3.19.1) package libssl3",
+		},
+		{
+			name:    "line of another file",
+			finding: Finding{Line: 4, Location: "Deployment/shop/web/web", Report: "polaris.json"},
+			want:    "polaris.json resource Deployment/shop/web/web",
+		},
+		{
+			name:    "no location",
+			finding: Finding{RuleID: "rule"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeLocations(sarifLocations(tt.finding)); got != tt.want {
+				t.Errorf("sarifLocations() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalSarif(t *testing.T) {
+	var all []Finding
+	for _, report := range []string{"gitleaks.json", "trivy-fs.json", "trivy-image.json", "semgrep.json", "polaris.json", "zap.json"} {
+		data, err := os.ReadFile(filepath.Join("testdata", report))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, _, err := Parse(report, data)
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", report, err)
+		}
+		all = append(all, parsed...)
+	}
+
+	data, err := MarshalSarif(Dedupe(all))
+	if err != nil {
+		t.Fatalf("MarshalSarif() error = %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatal(err)
+	}
+
+	results := 0
+	for _, run := range log.Runs {
+		for _, result := range run.Results {
+			results++
+			if result.RuleIndex >= len(run.Tool.Driver.Rules) || run.Tool.Driver.Rules[result.RuleIndex].ID != result.RuleID {
+				t.Errorf("%s: rule index %d does not point to its rule", result.RuleID, result.RuleIndex)
+			}
+			// GitHub code scanning rejects results without a valid file location
+			if len(result.Locations) == 0 || result.Locations[0].PhysicalLocation == nil {
+				t.Errorf("%s: no file location", result.RuleID)
+				continue
+			}
+			uri := result.Locations[0].PhysicalLocation.ArtifactLocation.URI
+			if u, err := url.Parse(uri); err != nil || u.IsAbs() || strings.ContainsAny(uri, " ()") {
+				t.Errorf("%s: artifact location %q is not a relative URI reference", result.RuleID, uri)
+			}
+		}
+	}
+	if results != len(Dedupe(all)) {
+		t.Errorf("MarshalSarif() = %d result(s), want %d", results, len(Dedupe(all)))
+	}
+}
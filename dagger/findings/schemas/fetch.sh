@@ -0,0 +1,14 @@
+#!/bin/bash
+# Vendors the GitLab security report schemas of a version next to this script,
+# where GitlabReports embeds them. Run through go generate ./findings.
+
+set -euo pipefail
+
+version=${1:?usage: fetch.sh <schema version>}
+base="https://gitlab.com/gitlab-org/security-products/security-report-schemas/-/raw/v${version}/dist"
+
+cd "$(dirname "$0")"
+for type in secret-detection sast dependency-scanning container-scanning dast; do
+    echo "→ ${type}-report-format.json (${version})"
+    curl -fsSL -o "${type}-report-format.json" "${base}/${type}-report-format.json"
+done
@@ -0,0 +1,289 @@
+package findings
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SuppressionFile is the name of the suppression file at the source root
+const SuppressionFile = ".devsecops-ignore.yml"
+
+// suppressionDateLayout is the format of suppression expiry dates
+const suppressionDateLayout = "2006-01-02"
+
+// Suppression is a justified exception for findings, matched by rule, CVE or
+// fingerprint and/or by path
+type Suppression struct {
+	// Rule id, CVE/GHSA (or any alias) or finding fingerprint
+	ID string `json:"id,omitempty" yaml:"id"`
+	// Glob of the finding file or location ("**" matches any directories)
+	Path    string `json:"path,omitempty" yaml:"path"`
+	Reason  string `json:"reason" yaml:"reason"`
+	Owner   string `json:"owner,omitempty" yaml:"owner"`
+	Expires string `json:"expires,omitempty" yaml:"expires"`
+}
+
+// ParseSuppressions reads a suppression file: a YAML (or JSON) document with
+// a "suppressions" key, or a top-level list, holding the suppressions.
+//
+//	suppressions:
+//	  - id: CVE-2024-1234
+//	    path: "frontend/**"
+//	    reason: Not reachable, the vulnerable parser is never called
+//	    owner: team-web
+//	    expires: 2025-06-30
+func ParseSuppressions(data []byte) ([]Suppression, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", SuppressionFile, err)
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+
+	var suppressions []Suppression
+	var file struct {
+		Suppressions []Suppression `yaml:"suppressions"`
+	}
+	var out any = &file
+	if root.Content[0].Kind == yaml.SequenceNode {
+		out = &suppressions
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", SuppressionFile, err)
+	}
+	if out == &file {
+		suppressions = file.Suppressions
+	}
+
+	for i, s := range suppressions {
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("invalid %s: suppression %d: %w", SuppressionFile, i+1, err)
+		}
+	}
+	return suppressions, nil
+}
+
+func (s Suppression) validate() error {
+	if s.ID == "" && s.Path == "" {
+		return fmt.Errorf("id or path is required")
+	}
+	if strings.TrimSpace(s.Reason) == "" {
+		return fmt.Errorf("%s: reason is required", s.label())
+	}
+	if s.Expires != "" {
+		if _, err := time.Parse(suppressionDateLayout, s.Expires); err != nil {
+			return fmt.Errorf("%s: invalid expiry date %q (expected YYYY-MM-DD)", s.label(), s.Expires)
+		}
+	}
+	if _, err := path.Match(strings.ReplaceAll(s.Path, "**", "*"), ""); err != nil {
+		return fmt.Errorf("%s: invalid path glob %q", s.label(), s.Path)
+	}
+	return nil
+}
+
+// Expired reports whether the suppression expired before now. A suppression
+// is valid through its expiry date.
+func (s Suppression) Expired(now time.Time) bool {
+	if s.Expires == "" {
+		return false
+	}
+	expires, err := time.Parse(suppressionDateLayout, s.Expires)
+	if err != nil {
+		return true
+	}
+	return now.UTC().Format(suppressionDateLayout) > expires.Format(suppressionDateLayout)
+}
+
+// Matches reports whether the suppression applies to a finding. file is the
+// finding file relative to the suppression file (e.g. prefixed with the
+// subproject path).
+func (s Suppression) Matches(f Finding, file string) bool {
+	if s.ID != "" {
+		ids := append([]string{f.RuleID, f.Fingerprint}, f.Aliases...)
+		if !slices.ContainsFunc(ids, func(id string) bool { return strings.EqualFold(id, s.ID) }) {
+			return false
+		}
+	}
+	if s.Path != "" {
+		return matchGlob(s.Path, file) || (f.Location != "" && matchGlob(s.Path, f.Location))
+	}
+	return true
+}
+
+// label identifies the suppression in messages
+func (s Suppression) label() string {
+	switch {
+	case s.ID != "" && s.Path != "":
+		return s.ID + " in " + s.Path
+	case s.ID != "":
+		return s.ID
+	default:
+		return s.Path
+	}
+}
+
+// String describes the suppression on a single line
+func (s Suppression) String() string {
+	str := s.label()
+	if s.Owner != "" {
+		str += " (owner " + s.Owner + ")"
+	}
+	if s.Expires != "" {
+		str += ", expires " + s.Expires
+	}
+	return str + ": " + s.Reason
+}
+
+// Suppress removes the findings matched by a valid suppression. Suppressions
+// that expired are not applied: the findings they match are returned as
+// expired, each described with the suppression. prefix is the path of the
+// scanned project relative to the suppression file.
+func Suppress(findings []Finding, suppressions []Suppression, prefix string, now time.Time) (kept []Finding, suppressed int, expired []string) {
+	for _, f := range findings {
+		file := strings.TrimPrefix(f.File, "./")
+		if file != "" && prefix != "" && prefix != "." {
+			file = path.Join(prefix, file)
+		}
+
+		matched := false
+		var expiredBy []string
+		for _, s := range suppressions {
+			if !s.Matches(f, file) {
+				continue
+			}
+			if s.Expired(now) {
+				expiredBy = append(expiredBy, fmt.Sprintf("%s (suppression %s expired on %s)", f, s.label(), s.Expires))
+				continue
+			}
+			matched = true
+			break
+		}
+
+		if matched {
+			suppressed++
+			continue
+		}
+		kept = append(kept, f)
+		expired = append(expired, expiredBy...)
+	}
+	return kept, suppressed, expired
+}
+
+// matchGlob matches a slash-separated name against a glob where "**" matches
+// any number of directories and a trailing "/**" anything below a directory
+func matchGlob(pattern, name string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	name = strings.TrimPrefix(name, "./")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// NativeIgnoreFiles translates the valid suppressions into the ignore files of
+// the CI template tools, keyed by file name:
+//
+//   - .trivyignore: CVE, advisory and check ids, with their expiry date
+//   - .gitleaksignore: Gitleaks fingerprints (ids containing ":") and rule ids
+//   - .semgrepignore: paths of suppressions without an id
+//   - semgrep-exclude-rules.txt: --exclude-rule arguments for Semgrep check ids
+//
+// Suppressions a tool cannot express (an id restricted to a path, for Trivy
+// and Semgrep, or a Gitleaks rule id) are written as comments rather than
+// widened to the whole source: only scans filtering the parsed findings, like
+// Suppress, apply them.
+func NativeIgnoreFiles(suppressions []Suppression, now time.Time) map[string]string {
+	var trivy, gitleaks, semgrepPaths, semgrepRules []string
+	header := "# Generated from " + SuppressionFile + ", do not edit\n"
+
+	for _, s := range suppressions {
+		if s.Expired(now) {
+			continue
+		}
+		comment := "# " + s.String()
+
+		switch {
+		case s.ID == "":
+			semgrepPaths = append(semgrepPaths, comment, s.Path)
+		case strings.Contains(s.ID, ":"):
+			gitleaks = append(gitleaks, comment, s.ID)
+		case gitleaksRuleID(s.ID):
+			// .gitleaksignore only matches fingerprints
+			gitleaks = append(gitleaks, comment, "# "+s.ID+" (rule id, not applied by Gitleaks)")
+		case strings.Contains(s.ID, "."):
+			// Semgrep check ids are dotted paths (javascript.express.security...)
+			if s.Path != "" {
+				// --exclude-rule cannot restrict a rule to a path
+				semgrepPaths = append(semgrepPaths, comment, "# --exclude-rule="+s.ID+" (path-scoped, not applied by Semgrep)")
+				continue
+			}
+			semgrepRules = append(semgrepRules, "--exclude-rule="+s.ID)
+		default:
+			entry := s.ID
+			if s.Expires != "" {
+				entry += " exp:" + s.Expires
+			}
+			if s.Path != "" {
+				// .trivyignore cannot restrict an id to a path
+				entry = "# " + entry + " (path-scoped, not applied by Trivy)"
+			}
+			trivy = append(trivy, comment, entry)
+		}
+	}
+
+	join := func(lines []string) string {
+		if len(lines) == 0 {
+			return header
+		}
+		return header + strings.Join(lines, "\n") + "\n"
+	}
+	return map[string]string{
+		".trivyignore":              join(trivy),
+		".gitleaksignore":           join(gitleaks),
+		".semgrepignore":            join(semgrepPaths),
+		"semgrep-exclude-rules.txt": strings.Join(append(semgrepRules, ""), "\n"),
+	}
+}
+
+// advisoryPrefixes are the prefixes of the advisory ids reported by the
+// dependency scanners, whatever their case
+var advisoryPrefixes = []string{"CVE-", "GHSA-", "PYSEC-", "OSV-", "GO-", "RUSTSEC-", "PKSA-", "NPM-"}
+
+// gitleaksRuleID reports whether an id is a Gitleaks rule id: lowercase words
+// joined by hyphens (aws-access-token, generic-api-key), unlike the uppercase
+// Trivy check ids and the advisory ids
+func gitleaksRuleID(id string) bool {
+	if id != strings.ToLower(id) || strings.ContainsAny(id, ".: ") {
+		return false
+	}
+	return !slices.ContainsFunc(advisoryPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(strings.ToUpper(id), prefix)
+	})
+}
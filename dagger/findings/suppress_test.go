@@ -0,0 +1,137 @@
+package findings
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNativeIgnoreFiles(t *testing.T) {
+	suppressions := []Suppression{
+		{ID: "CVE-2024-29041", Reason: "Not reachable", Expires: "2030-01-01"},
+		{ID: "ghsa-qw6h-vgh9-j6wx", Reason: "Redirects are not user-controlled"},
+		{ID: "npm-1179", Reason: "Dev dependency"},
+		{ID: "KSV001", Path: "k8s/**", Reason: "Privileged by design"},
+		{ID: "aws-access-token", Reason: "Documented example keys"},
+		{ID: "config/settings.py:aws-access-token:3", Reason: "Revoked"},
+		{ID: "javascript.express.security.audit.xss.direct-response-write.direct-response-write", Reason: "Escaped upstream"},
+		{Path: "test/fixtures/**", Reason: "Test data"},
+		{ID: "CVE-2020-8203", Reason: "Expired", Expires: "2020-01-01"},
+	}
+
+	files := NativeIgnoreFiles(suppressions, time.Date(2024, 11, 5, 0, 0, 0, 0, time.UTC))
+
+	// entries lists the lines of a file that are not comments
+	entries := func(file string) []string {
+		var lines []string
+		for _, line := range strings.Split(files[file], "\n") {
+			if line != "" && !strings.HasPrefix(line, "#") {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{file: ".trivyignore", want: []string{"CVE-2024-29041 exp:2030-01-01", "ghsa-qw6h-vgh9-j6wx", "npm-1179"}},
+		{file: ".gitleaksignore", want: []string{"config/settings.py:aws-access-token:3"}},
+		{file: ".semgrepignore", want: []string{"test/fixtures/**"}},
+		{file: "semgrep-exclude-rules.txt", want: []string{"--exclude-rule=javascript.express.security.audit.xss.direct-response-write.direct-response-write"}},
+	}
+	for _, tt := range tests {
+		if got := entries(tt.file); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s entries = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+
+	// Suppressions a tool cannot express are only written as comments
+	for file, want := range map[string]string{
+		".trivyignore":    "# KSV001 (path-scoped, not applied by Trivy)",
+		".gitleaksignore": "# aws-access-token (rule id, not applied by Gitleaks)",
+	} {
+		if !strings.Contains(files[file], want+"\n") {
+			t.Errorf("%s does not contain %q:\n%s", file, want, files[file])
+		}
+	}
+	if strings.Contains(files[".trivyignore"], "aws-access-token") {
+		t.Errorf(".trivyignore contains the Gitleaks rule id:\n%s", files[".trivyignore"])
+	}
+}
+
+func TestParseSuppressions(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "yaml",
+			data: `# Reviewed quarterly
+suppressions:
+  - id: CVE-2024-1234
+    path: "frontend/**"
+    reason: Not reachable # the parser is never called
+    owner: team-web
+    expires: 2025-06-30
+  - path: 'test/fixtures/**'
+    reason: "Test data, #not a comment"
+`,
+			want: []string{
+				"CVE-2024-1234 in frontend/** (owner team-web), expires 2025-06-30: Not reachable",
+				"test/fixtures/**: Test data, #not a comment",
+			},
+		},
+		{
+			name: "yaml list",
+			data: "- id: KSV001\n  reason: Privileged by design\n",
+			want: []string{"KSV001: Privileged by design"},
+		},
+		{
+			name: "json",
+			data: `{"suppressions": [{"id": "npm-1179", "reason": "Dev dependency"}]}`,
+			want: []string{"npm-1179: Dev dependency"},
+		},
+		{
+			name: "json list",
+			data: `[{"id": "npm-1179", "reason": "Dev dependency"}]`,
+			want: []string{"npm-1179: Dev dependency"},
+		},
+		{name: "empty", data: "\n"},
+		{name: "comments only", data: "# Nothing suppressed yet\n"},
+		{name: "no suppressions", data: "suppressions: []\n"},
+		{name: "unknown key", data: "suppressions:\n  - id: KSV001\n    reason: r\n    until: 2025-06-30\n", wantErr: "field until not found"},
+		{name: "unknown top-level key", data: "ignores: []\n", wantErr: "field ignores not found"},
+		{name: "missing reason", data: "- id: KSV001\n", wantErr: "suppression 1: KSV001: reason is required"},
+		{name: "missing id and path", data: "- reason: r\n", wantErr: "id or path is required"},
+		{name: "invalid date", data: "- id: KSV001\n  reason: r\n  expires: 30/06/2025\n", wantErr: "invalid expiry date"},
+		{name: "not a list", data: "suppressions: KSV001\n", wantErr: "invalid " + SuppressionFile},
+		{name: "invalid yaml", data: "- id: [KSV001\n", wantErr: "invalid " + SuppressionFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suppressions, err := ParseSuppressions([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseSuppressions() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSuppressions() error = %v", err)
+			}
+
+			var got []string
+			for _, s := range suppressions {
+				got = append(got, s.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("ParseSuppressions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
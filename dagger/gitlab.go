@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"dagger/devsecops/findings"
+	"dagger/devsecops/internal/dagger"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GitlabReports converts every report in a reports directory (e.g. the reports
+// of a Test run) into GitLab security reports (gl-secret-detection-report.json,
+// gl-sast-report.json, gl-dependency-scanning-report.json,
+// gl-container-scanning-report.json, gl-dast-report.json), validated against
+// the GitLab report schemas vendored in the module, without network access.
+// Only report types with a source report are produced.
+func (m *Devsecops) GitlabReports(
+	ctx context.Context,
+	// Directory containing scanner reports (gitleaks-report.json, dependency-scan.json, ...)
+	// +required
+	reports *dagger.Directory,
+	// Validate the converted reports against the GitLab security report schemas
+	// +default=true
+	validate bool,
+) (*dagger.Directory, error) {
+	fmt.Printf("🦊 Converting reports to GitLab security report schema %s...\n", findings.GitlabSchemaVersion)
+	start := time.Now()
+
+	paths, err := reports.Glob(ctx, "**/*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+	slices.Sort(paths)
+
+	byType := map[string][]findings.Finding{}
+	tools := map[string][]string{}
+	for _, p := range paths {
+		if strings.HasPrefix(path.Base(p), "gl-") {
+			continue
+		}
+		contents, err := reports.File(p).Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report %s: %w", p, err)
+		}
+
+		parsed, format, err := findings.Parse(p, []byte(contents))
+		if err != nil {
+			return nil, err
+		}
+		reportType, ok := findings.GitlabReportType(p, parsed)
+		if format == findings.FormatUnknown || !ok {
+			fmt.Printf("→ Skipping %s (no GitLab report type)\n", p)
+			continue
+		}
+		fmt.Printf("→ %s: %d finding(s) for %s\n", p, len(parsed), reportType)
+
+		rootRelative(p, parsed)
+
+		byType[reportType] = append(byType[reportType], parsed...)
+		tool := string(format)
+		if len(parsed) > 0 {
+			tool = parsed[0].Tool
+		}
+		if !slices.Contains(tools[reportType], tool) {
+			tools[reportType] = append(tools[reportType], tool)
+		}
+	}
+
+	out := dag.Directory()
+	var files []string
+	for _, reportType := range findings.GitlabReportTypes {
+		if _, ok := tools[reportType]; !ok {
+			continue
+		}
+		data, err := findings.MarshalGitlabReport(reportType, findings.Dedupe(byType[reportType]), tools[reportType], start, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		file := findings.GitlabReportFile(reportType)
+		out = out.WithNewFile(file, string(data)+"\n")
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no convertible reports found")
+	}
+
+	if validate {
+		if err := validateGitlabReports(ctx, out, files); err != nil {
+			return nil, err
+		}
+		fmt.Printf("✅ %s valid against schema %s\n", strings.Join(files, ", "), findings.GitlabSchemaVersion)
+	}
+
+	return out, nil
+}
+
+// validateGitlabReports validates GitLab security reports against the
+// schemas vendored in the module, and returns an error with the violations of
+// every invalid report
+func validateGitlabReports(ctx context.Context, reports *dagger.Directory, files []string) error {
+	var problems []string
+	for _, file := range files {
+		contents, err := reports.File(file).Contents(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		reportType := strings.ReplaceAll(strings.TrimSuffix(strings.TrimPrefix(file, "gl-"), "-report.json"), "-", "_")
+		violations, err := findings.ValidateGitlabReport(reportType, []byte(contents))
+		if err != nil {
+			return fmt.Errorf("failed to validate %s: %w", file, err)
+		}
+		if len(violations) > 0 {
+			problems = append(problems, file+":")
+			problems = append(problems, listed(violations)...)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("GitLab security report(s) do not match schema %s:\n%s",
+			findings.GitlabSchemaVersion, strings.Join(problems, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/devsecops/internal/dagger"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ToolVersions holds the container image of every tool the module runs
+type ToolVersions struct {
+	// Registry mirror prefixed to the default images (empty for none)
+	Registry string
+	// Trivy (unified scans, container scanning, SBOMs and the Trivy server)
+	Trivy string
+	// Gitleaks (specialized secrets detection)
+	Gitleaks string
+	// Semgrep (SAST)
+	Semgrep string
+	// OWASP ZAP (DAST)
+	Zap string
+	// Node.js (npm/pnpm audit, builds and tests)
+	Node string
+	// Python (pip-audit, builds and tests)
+	Python string
+	// PHP (composer audit)
+	Php string
+	// Alpine (IaC tools, YAML validation, database bundles)
+	Alpine string
+	// Playwright (E2E tests), matching the @playwright/test version of projects
+	Playwright string
+	// Cypress (E2E tests), matching the cypress version of projects
+	Cypress string
+	// k6 (performance tests)
+	K6 string
+	// crane (pushes to registry services)
+	Crane string
+	// Distribution registry (local registry service)
+	Distribution string
+	// Whether images must be pinned by digest, including the images of
+	// language versions
+	RequireDigests bool
+}
+
+// toolNames lists the configurable tools in inventory order
+var toolNames = []string{"trivy", "gitleaks", "semgrep", "zap", "node", "python", "php", "alpine", "playwright", "cypress", "k6", "crane", "distribution"}
+
+// defaultToolVersions returns the images of the CI template jobs
+func defaultToolVersions() *ToolVersions {
+	return &ToolVersions{
+		Trivy:    "aquasec/trivy:0.58.1",
+		Gitleaks: "zricethezav/gitleaks:v8.21.2",
+		Semgrep:  "returntocorp/semgrep:1.97.0",
+		Zap:      "ghcr.io/zaproxy/zaproxy:2.15.0",
+		Node:     "node:20-alpine",
+		Python:   "python:3.12-slim",
+		Php:      "php:8.3-cli",
+		Alpine:   "alpine:3.20",
+
+		Playwright:   "mcr.microsoft.com/playwright:v1.49.1-noble",
+		Cypress:      "cypress/included:15.3.0",
+		K6:           "grafana/k6:0.55.0",
+		Crane:        "gcr.io/go-containerregistry/crane:v0.20.2",
+		Distribution: "registry:2.8.3",
+	}
+}
+
+// image returns the image field of a tool, or nil for an unknown tool
+func (t *ToolVersions) image(tool string) *string {
+	switch tool {
+	case "trivy":
+		return &t.Trivy
+	case "gitleaks":
+		return &t.Gitleaks
+	case "semgrep":
+		return &t.Semgrep
+	case "zap":
+		return &t.Zap
+	case "node":
+		return &t.Node
+	case "python":
+		return &t.Python
+	case "php":
+		return &t.Php
+	case "alpine":
+		return &t.Alpine
+	case "playwright":
+		return &t.Playwright
+	case "cypress":
+		return &t.Cypress
+	case "k6":
+		return &t.K6
+	case "crane":
+		return &t.Crane
+	case "distribution":
+		return &t.Distribution
+	}
+	return nil
+}
+
+// set replaces the image of a tool
+func (t *ToolVersions) set(tool, image string) error {
+	field := t.image(tool)
+	if field == nil {
+		return fmt.Errorf("unknown tool %q (expected one of %s)", tool, strings.Join(toolNames, ", "))
+	}
+	if image == "" {
+		return fmt.Errorf("empty image for %s", tool)
+	}
+	*field = image
+	return nil
+}
+
+// mirrored prefixes an image with the registry mirror, if any
+func (t *ToolVersions) mirrored(image string) string {
+	if t.Registry == "" {
+		return image
+	}
+	return strings.TrimSuffix(t.Registry, "/") + "/" + image
+}
+
+// pinned reports whether an image is pinned by digest
+func pinned(image string) bool {
+	_, digest, ok := strings.Cut(image, "@")
+	return ok && strings.HasPrefix(digest, "sha256:")
+}
+
+// newToolVersions resolves the tool images: the defaults, prefixed with the
+// registry mirror, then the images of the config file and the overrides,
+// taken verbatim. The mirror argument takes precedence over the config file.
+func newToolVersions(
+	ctx context.Context,
+	registryMirror string,
+	overrides []string,
+	config *dagger.File,
+	requireDigests bool,
+) (*ToolVersions, error) {
+	var configured map[string]string
+	if config != nil {
+		contents, err := config.Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the tool config file: %w", err)
+		}
+		if configured, err = parseToolConfig(contents); err != nil {
+			return nil, err
+		}
+	}
+
+	tools := defaultToolVersions()
+	tools.Registry = cmp.Or(registryMirror, configured["registry"])
+	for _, tool := range toolNames {
+		field := tools.image(tool)
+		*field = tools.mirrored(*field)
+	}
+
+	for _, tool := range toolNames {
+		image, ok := configured[tool]
+		if !ok {
+			continue
+		}
+		if err := tools.set(tool, image); err != nil {
+			return nil, fmt.Errorf("tool config file: %w", err)
+		}
+	}
+	for _, override := range overrides {
+		tool, image, ok := strings.Cut(override, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tool image %q (expected tool=image)", override)
+		}
+		if err := tools.set(strings.TrimSpace(tool), strings.TrimSpace(image)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Digests are checked as images are used, so that a call only requires
+	// the images it runs to be pinned
+	tools.RequireDigests = requireDigests
+	return tools, nil
+}
+
+// parseToolConfig reads a tool config file: a flat YAML mapping of "registry"
+// and tool names to images.
+//
+//	registry: registry.example.com/mirror
+//	trivy: aquasec/trivy:0.58.1@sha256:...
+func parseToolConfig(contents string) (map[string]string, error) {
+	var config map[string]string
+	if err := yaml.Unmarshal([]byte(contents), &config); err != nil {
+		return nil, fmt.Errorf("tool config file: %w", err)
+	}
+	for _, key := range slices.Sorted(maps.Keys(config)) {
+		if key != "registry" && !slices.Contains(toolNames, key) {
+			return nil, fmt.Errorf("tool config file: unknown key %q (expected registry or one of %s)",
+				key, strings.Join(toolNames, ", "))
+		}
+	}
+	return config, nil
+}
+
+// tools returns the configured tool images
+func (m *Devsecops) tools() *ToolVersions {
+	if m.Tools == nil {
+		return defaultToolVersions()
+	}
+	return m.Tools
+}
+
+// image returns the configured image of a tool, which must be pinned by
+// digest with requireDigests
+func (m *Devsecops) image(tool string) (string, error) {
+	tools := m.tools()
+	image := *tools.image(tool)
+	if tools.RequireDigests && !pinned(image) {
+		return "", fmt.Errorf("%s image %s not pinned by digest: configure %s=<image>@sha256:...", tool, image, tool)
+	}
+	return image, nil
+}
+
+// versionedImage returns the image of a language tool for a version: the
+// configured image by default, or the mirrored image of the version (the
+// format is the image reference with a %s for the version). A digest after
+// the version, e.g. "3.12@sha256:...", pins the image, as required with
+// requireDigests.
+func (m *Devsecops) versionedImage(tool, format, version string) (string, error) {
+	if version == "" {
+		return m.image(tool)
+	}
+	tools := m.tools()
+	version, digest, _ := strings.Cut(version, "@")
+	image := tools.mirrored(fmt.Sprintf(format, version))
+	if digest != "" {
+		image += "@" + digest
+	}
+	if tools.RequireDigests && !pinned(image) {
+		return "", fmt.Errorf("%s image %s not pinned by digest: add the digest to the version (%s@sha256:...) or use the configured image", tool, image, version)
+	}
+	return image, nil
+}
+
+// ToolInventory lists the effective image of every tool and whether it is
+// pinned by digest
+func (m *Devsecops) ToolInventory() string {
+	tools := m.tools()
+
+	var out strings.Builder
+	w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOOL\tIMAGE\tPINNED")
+	for _, tool := range toolNames {
+		image := *tools.image(tool)
+		pin := "no"
+		if pinned(image) {
+			pin = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", tool, image, pin)
+	}
+	w.Flush()
+
+	if tools.Registry != "" {
+		fmt.Fprintf(&out, "\nRegistry mirror: %s\n", tools.Registry)
+	}
+	return out.String()
+}
@@ -6,160 +6,1265 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"dagger/devsecops/findings"
 	"dagger/devsecops/internal/dagger"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
 )
 
-type Devsecops struct{}
+type Devsecops struct {
+	// Container images of the tools
+	Tools *ToolVersions
+	// Pre-fetched Trivy cache holding db/ and java-db/ (see FetchDatabases)
+	// +private
+	TrivyDb *dagger.Directory
+	// Local Semgrep rules used instead of the registry ruleset
+	// +private
+	SemgrepRules *dagger.Directory
+}
+
+func New(
+	ctx context.Context,
+	// Registry mirror prefixed to the default tool images
+	// (e.g. "registry.example.com/mirror")
+	// +optional
+	registryMirror string,
+	// Tool image overrides as tool=image, taken verbatim
+	// (e.g. "trivy=registry.example.com/aquasec/trivy:0.58.1@sha256:...")
+	// +optional
+	toolImage []string,
+	// Tool config file: a YAML mapping of "registry" and tool names to images
+	// +optional
+	toolConfig *dagger.File,
+	// Fail calls running a tool image not pinned by an @sha256: digest
+	// +optional
+	requireDigests bool,
+	// Pre-fetched Trivy cache directory (db/ and java-db/, e.g. the trivy/
+	// directory of FetchDatabases): Trivy scans run offline with it
+	// +optional
+	trivyDb *dagger.Directory,
+	// Local Semgrep rules directory (e.g. the semgrep/ directory of
+	// FetchDatabases), scanned with instead of the p/security-audit registry ruleset
+	// +optional
+	semgrepRules *dagger.Directory,
+) (*Devsecops, error) {
+	tools, err := newToolVersions(ctx, registryMirror, toolImage, toolConfig, requireDigests)
+	if err != nil {
+		return nil, err
+	}
+	return &Devsecops{
+		Tools:        tools,
+		TrivyDb:      trivyDb,
+		SemgrepRules: semgrepRules,
+	}, nil
+}
 
-// Test runs all security scans on a project
+// Test runs all security scans on a project and returns their results and
+// reports, whatever the outcome: gate on the security policy with check
 func (m *Devsecops) Test(
 	ctx context.Context,
 	// +required
 	source *dagger.Directory,
-	// Language of the project (node, python, php)
-	// +default="node"
+	// Language of the project (auto, node, python, php, generic)
+	// +default="auto"
 	language string,
-) error {
+	// Scanner: "trivy" (unified, the DEVSECOPS_SECURITY_SCANNER default) or "specialized"
+	// +default="trivy"
+	scanner string,
+	// SAST tool alongside the scanner, like DEVSECOPS_SAST_TOOL: "semgrep" or "trivy"
+	// +default="semgrep"
+	sastTool string,
+	// Security policy: "strict" (fail on findings) or "permissive" (report only)
+	// +default="strict"
+	policy string,
+	// Minimum failing severity, or a DEVSECOPS_TRIVY_SEVERITY-style list (its lowest entry)
+	// +default="HIGH"
+	failSeverity string,
+	// Per-scanner overrides, e.g. "secrets=LOW", "semgrep=CRITICAL" or "dependencies=off"
+	// +optional
+	scannerSeverity []string,
+	// Monorepo subproject paths to scan (e.g. "frontend"), like DEVSECOPS_PROJECT_PATH
+	// +optional
+	projectPath []string,
+	// Discover projects by their manifest files (the root, or the outermost
+	// directories with one) and scan each of them
+	// +optional
+	discover bool,
+	// Maximum number of scanners running at the same time (0 for no limit)
+	// +optional
+	maxParallel int,
+	// Also scan Infrastructure as Code files, like DEVSECOPS_ENABLE_IAC_SCAN
+	// +optional
+	iac bool,
+	// Directory with IaC files in each project (DEVSECOPS_IAC_TARGET_DIR)
+	// +default="k8s"
+	iacTargetDir string,
+	// Baseline reports directory (e.g. exported from a run on the target branch):
+	// only findings missing from it are gated
+	// +optional
+	baseline *dagger.Directory,
+	// Baseline source (e.g. a target branch checkout) scanned like the source
+	// to build the baseline
+	// +optional
+	baselineSource *dagger.Directory,
+) (*ScanRun, error) {
 	fmt.Println("🔒 Running DevSecOps pipeline tests...")
 
-	// Run all security scans in parallel (Dagger handles parallelization automatically)
+	gate, err := findings.ParsePolicy(policy, failSeverity, scannerSeverity)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := scanOptions{
+		language:     language,
+		scanner:      scanner,
+		sastTool:     sastTool,
+		iac:          iac,
+		iacTargetDir: iacTargetDir,
+	}
+
+	paths := projectPath
+	if discover {
+		discovered, err := discoverProjects(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("🔎 Discovered %d project(s): %s\n", len(discovered), strings.Join(discovered, ", "))
+		for _, path := range discovered {
+			if !slices.Contains(paths, path) {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	scanPaths := paths
+	if len(scanPaths) == 0 {
+		scanPaths = []string{"."}
+	}
+
+	opts.suppressions, err = loadSuppressions(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case baseline != nil:
+		opts.baseline, err = loadBaseline(ctx, baseline)
+	case baselineSource != nil:
+		opts.baseline, err = m.scanProjectsBaseline(ctx, baselineSource, scanPaths, opts, maxParallel)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runs, err := m.scanProjects(ctx, source, scanPaths, opts, gate, maxParallel)
+	if err != nil {
+		return nil, err
+	}
+	run := mergeRuns(runs)
+
+	if problems := run.problems(); len(problems) > 0 {
+		fmt.Printf("❌ %s policy violated by %d security scan(s), see check\n", gate.Mode, len(problems))
+		return run, nil
+	}
+
+	fmt.Println("✅ All security scans passed!")
+	return run, nil
+}
+
+// scanProjects runs all security scans of the given (sub)project paths
+// concurrently, at most maxParallel scanners at a time. Every scanner runs to
+// completion: failures are recorded on the scan results rather than stopping
+// the other scanners.
+func (m *Devsecops) scanProjects(
+	ctx context.Context,
+	source *dagger.Directory,
+	paths []string,
+	opts scanOptions,
+	gate *findings.Policy,
+	maxParallel int,
+) ([]*ScanRun, error) {
+	type scanJob struct {
+		run   *ScanRun
+		index int
+		spec  *scanSpec
+	}
+
+	runs := make([]*ScanRun, len(paths))
+	var jobs []scanJob
+	for i, path := range paths {
+		dir := source
+		if path != "." {
+			dir = source.Directory(path)
+		}
+
+		project, err := resolveProject(ctx, dir, opts.language, "auto")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		specs, err := m.projectScans(ctx, dir, project, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range specs {
+			spec.useSuppressions(opts.suppressions, path)
+			spec.useBaseline(opts.baseline, path)
+		}
+
+		runs[i] = &ScanRun{
+			Path:    path,
+			Project: project,
+			Scans:   make([]*ScanResult, len(specs)),
+			Summary: &SeverityCounts{},
+			Reports: dag.Directory(),
+		}
+		for index, spec := range specs {
+			jobs = append(jobs, scanJob{run: runs[i], index: index, spec: spec})
+		}
+	}
+
+	var eg errgroup.Group
+	if maxParallel > 0 {
+		eg.SetLimit(maxParallel)
+	}
+	for _, job := range jobs {
+		eg.Go(func() error {
+			result, _ := job.spec.run(ctx, gate)
+			job.run.Scans[job.index] = result
+			printScanResult(job.run.Path, result)
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	for _, run := range runs {
+		run.collect()
+	}
+	return runs, nil
+}
+
+// printScanResult prints the outcome of a scan of the given (sub)project path
+func printScanResult(path string, result *ScanResult) {
+	prefix := ""
+	if path != "." {
+		prefix = "[" + path + "] "
+	}
+	icon := "✅"
+	switch result.Status {
+	case "warning":
+		icon = "⚠️ "
+	case "failed", "error":
+		icon = "❌"
+	case "skipped":
+		icon = "⏭️ "
+	}
+	details := ""
+	if result.Baseline {
+		details = fmt.Sprintf(" (%d new, %d fixed)", len(result.Added), len(result.Fixed))
+	}
+	if result.DbAge != "" {
+		details += fmt.Sprintf(" (DB %s old)", result.DbAge)
+	}
+	fmt.Printf("%s %s%s (%s): %s in %s, %d finding(s)%s\n",
+		icon, prefix, result.Name, result.Tool, result.Status, result.Duration, result.Findings.Total, details)
+}
+
+// collect sums the finding counts and gathers the reports of the scans of a run
+func (r *ScanRun) collect() {
+	for _, result := range r.Scans {
+		r.Summary.add(result.Findings)
+		if result.Status != "skipped" {
+			r.Reports = r.Reports.WithFile(result.ReportPath, result.Report)
+		}
+	}
+}
 
+// scanOptions selects the scanners Test runs on each (sub)project
+type scanOptions struct {
+	language     string
+	scanner      string
+	sastTool     string
+	iac          bool
+	iacTargetDir string
+	// Findings to compare against, nil outside baseline mode
+	baseline baselineFindings
+	// Suppressions of the source root suppression file
+	suppressions []findings.Suppression
+}
+
+// projectScans returns the scans to run on a project
+func (m *Devsecops) projectScans(ctx context.Context, source *dagger.Directory, project *Project, opts scanOptions) ([]*scanSpec, error) {
 	// 1. Secrets Detection
-	secretsScan := m.SecretsDetection(ctx, source)
+	secrets, err := m.secretsScan(source, opts.scanner)
+	if err != nil {
+		return nil, err
+	}
 
 	// 2. Dependency Scanning
-	depScan := m.DependencyScanning(ctx, source, language)
+	dependencies, err := m.dependencyScan(ctx, source, project, opts.scanner)
+	if err != nil {
+		return nil, err
+	}
 
 	// 3. SAST Scanning
-	sastScan := m.SastScanning(ctx, source)
+	sast, err := m.sastScans(source, opts.scanner, opts.sastTool)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := append([]*scanSpec{secrets, dependencies}, sast...)
 
-	// Wait for all scans
-	if _, err := secretsScan.Sync(ctx); err != nil {
-		return fmt.Errorf("secrets detection failed: %w", err)
+	// 4. IaC Scanning
+	if opts.iac {
+		iac, err := m.iacScan(source, opts.iacTargetDir, opts.scanner)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, iac)
 	}
 
-	if _, err := depScan.Sync(ctx); err != nil {
-		return fmt.Errorf("dependency scanning failed: %w", err)
+	return specs, nil
+}
+
+// mergeRuns combines the runs of monorepo subprojects. Reports are laid out
+// under each subproject path. The run of a whole source is returned as is.
+func mergeRuns(runs []*ScanRun) *ScanRun {
+	if len(runs) == 1 && runs[0].Path == "." {
+		return runs[0]
+	}
+	merged := &ScanRun{
+		Path:        ".",
+		Project:     &Project{},
+		Subprojects: runs,
+		Summary:     &SeverityCounts{},
+		Reports:     dag.Directory(),
 	}
+	var languages, packageManagers []string
+	for _, run := range runs {
+		if !slices.Contains(languages, run.Project.Language) {
+			languages = append(languages, run.Project.Language)
+		}
+		if run.Project.PackageManager != "" && !slices.Contains(packageManagers, run.Project.PackageManager) {
+			packageManagers = append(packageManagers, run.Project.PackageManager)
+		}
+		for _, manifest := range run.Project.Manifests {
+			merged.Project.Manifests = append(merged.Project.Manifests, run.Path+"/"+manifest)
+		}
+		merged.Summary.add(run.Summary)
+		merged.Reports = merged.Reports.WithDirectory(run.Path, run.Reports)
+	}
+	merged.Project.Language = strings.Join(languages, ",")
+	merged.Project.PackageManager = strings.Join(packageManagers, ",")
+
+	fmt.Printf("📊 %d subproject(s) scanned, %d finding(s) in total\n", len(runs), merged.Summary.Total)
+	return merged
+}
 
-	if _, err := sastScan.Sync(ctx); err != nil {
-		return fmt.Errorf("SAST scanning failed: %w", err)
+// checkScanner validates a DEVSECOPS_SECURITY_SCANNER value
+func checkScanner(scanner string) error {
+	switch scanner {
+	case "", "trivy", "specialized":
+		return nil
+	default:
+		return fmt.Errorf("unknown scanner %q (expected \"trivy\" or \"specialized\")", scanner)
 	}
+}
 
-	fmt.Println("✅ All security scans passed!")
-	return nil
+// runScans runs the scans of a scan function on the source, applying its
+// suppression file and the baseline if given, and returns their results and
+// reports, whatever the outcome: gate on the security policy with check. The
+// project is detected when nil.
+func runScans(
+	ctx context.Context,
+	source *dagger.Directory,
+	project *Project,
+	baseline *dagger.Directory,
+	baselineSource *dagger.Directory,
+	gate *findings.Policy,
+	build func(source *dagger.Directory) ([]*scanSpec, error),
+) (*ScanRun, error) {
+	specs, err := build(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if project == nil {
+		if project, err = resolveProject(ctx, source, "auto", "auto"); err != nil {
+			return nil, err
+		}
+	}
+
+	suppressions, err := loadSuppressions(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := scanBaseline(ctx, baseline, baselineSource, build)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &ScanRun{
+		Path:    ".",
+		Project: project,
+		Summary: &SeverityCounts{},
+		Reports: dag.Directory(),
+	}
+	// Run every scan even if one fails the policy
+	for _, spec := range specs {
+		spec.useSuppressions(suppressions, ".")
+		spec.useBaseline(base, ".")
+
+		result, _ := spec.run(ctx, gate)
+		run.Scans = append(run.Scans, result)
+		printScanResult(run.Path, result)
+	}
+	run.collect()
+
+	if problems := run.problems(); len(problems) > 0 {
+		fmt.Printf("❌ %s policy violated by %d security scan(s), see check\n", gate.Mode, len(problems))
+	}
+	return run, nil
+}
+
+// trivyFsScan runs "trivy fs" with the given scanners on the source, like the
+// unified secrets-detection, dependency-scanning and sast jobs. Findings of
+// every severity are reported: the security policy picks the failing ones.
+func (m *Devsecops) trivyFsScan(source *dagger.Directory, name, scanners, report string) (*scanSpec, error) {
+	ctr, err := m.trivyClient()
+	if err != nil {
+		return nil, err
+	}
+	spec := &scanSpec{
+		name:   name,
+		tool:   "trivy",
+		report: report,
+		ctr: ctr.
+			WithMountedDirectory("/src", source).
+			WithWorkdir("/src"),
+		cmd: []string{
+			"trivy", "fs",
+			"--scanners", scanners,
+			"--exit-code", "0",
+			"--format", "json",
+			"--output", report,
+			".",
+		},
+	}
+	if scanners == "vuln" {
+		if spec.vulnDb, err = m.trivyDbMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
 }
 
-// SecretsDetection scans for secrets using Gitleaks
+// SecretsDetection scans for secrets using Trivy or Gitleaks and returns the
+// result and report, whatever the outcome: gate on the security policy with check
 func (m *Devsecops) SecretsDetection(
 	ctx context.Context,
 	// +required
 	source *dagger.Directory,
-) *dagger.Container {
+	// Scanner: "trivy" (unified, the DEVSECOPS_SECURITY_SCANNER default) or "specialized"
+	// +default="trivy"
+	scanner string,
+	// Security policy: "strict" (fail on findings) or "permissive" (report only)
+	// +default="strict"
+	policy string,
+	// Minimum failing severity, or a DEVSECOPS_TRIVY_SEVERITY-style list (its lowest entry)
+	// +default="HIGH"
+	failSeverity string,
+	// Per-scanner overrides, e.g. "secrets=LOW", "semgrep=CRITICAL" or "dependencies=off"
+	// +optional
+	scannerSeverity []string,
+	// Baseline reports directory (e.g. exported from a run on the target branch):
+	// only findings missing from it are gated
+	// +optional
+	baseline *dagger.Directory,
+	// Baseline source (e.g. a target branch checkout) scanned like the source
+	// to build the baseline
+	// +optional
+	baselineSource *dagger.Directory,
+) (*ScanRun, error) {
+	gate, err := findings.ParsePolicy(policy, failSeverity, scannerSeverity)
+	if err != nil {
+		return nil, err
+	}
+
+	return runScans(ctx, source, nil, baseline, baselineSource, gate, func(source *dagger.Directory) ([]*scanSpec, error) {
+		spec, err := m.secretsScan(source, scanner)
+		return []*scanSpec{spec}, err
+	})
+}
+
+func (m *Devsecops) secretsScan(source *dagger.Directory, scanner string) (*scanSpec, error) {
+	if err := checkScanner(scanner); err != nil {
+		return nil, err
+	}
+	if scanner != "specialized" {
+		fmt.Println("🔍 Running secrets detection with Trivy...")
+		return m.trivyFsScan(source, "secrets", "secret", "secrets-report.json")
+	}
+
 	fmt.Println("🔍 Running secrets detection with Gitleaks...")
 
-	return dag.Container().
-		From("zricethezav/gitleaks:v8.21.2").
-		WithMountedDirectory("/src", source).
-		WithWorkdir("/src").
-		WithExec([]string{
+	image, err := m.image("gitleaks")
+	if err != nil {
+		return nil, err
+	}
+	return &scanSpec{
+		name:   "secrets",
+		tool:   "gitleaks",
+		report: "gitleaks-report.json",
+		ctr: dag.Container().
+			From(image).
+			WithMountedDirectory("/src", source).
+			WithWorkdir("/src"),
+		cmd: []string{
 			"gitleaks", "detect",
 			"--redact",
 			"--source", ".",
 			"--report-path", "gitleaks-report.json",
 			"--report-format", "json",
 			"--no-git",
-		})
+		},
+	}, nil
 }
 
-// DependencyScanning scans dependencies for vulnerabilities
+// DependencyScanning scans dependencies for vulnerabilities and returns the
+// result and report, whatever the outcome: gate on the security policy with check
 func (m *Devsecops) DependencyScanning(
 	ctx context.Context,
 	// +required
 	source *dagger.Directory,
-	// +required
+	// Language of the project (auto, node, python, php, generic)
+	// +default="auto"
 	language string,
-) *dagger.Container {
-	fmt.Printf("📦 Running dependency scanning for %s...\n", language)
+	// Scanner: "trivy" (unified, the DEVSECOPS_SECURITY_SCANNER default) or "specialized"
+	// +default="trivy"
+	scanner string,
+	// Security policy: "strict" (fail on findings) or "permissive" (report only)
+	// +default="strict"
+	policy string,
+	// Minimum failing severity, or a DEVSECOPS_TRIVY_SEVERITY-style list (its lowest entry)
+	// +default="HIGH"
+	failSeverity string,
+	// Per-scanner overrides, e.g. "secrets=LOW", "semgrep=CRITICAL" or "dependencies=off"
+	// +optional
+	scannerSeverity []string,
+	// Baseline reports directory (e.g. exported from a run on the target branch):
+	// only findings missing from it are gated
+	// +optional
+	baseline *dagger.Directory,
+	// Baseline source (e.g. a target branch checkout) scanned like the source
+	// to build the baseline
+	// +optional
+	baselineSource *dagger.Directory,
+) (*ScanRun, error) {
+	gate, err := findings.ParsePolicy(policy, failSeverity, scannerSeverity)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := resolveProject(ctx, source, language, "auto")
+	if err != nil {
+		return nil, err
+	}
+
+	return runScans(ctx, source, project, baseline, baselineSource, gate, func(source *dagger.Directory) ([]*scanSpec, error) {
+		spec, err := m.dependencyScan(ctx, source, project, scanner)
+		return []*scanSpec{spec}, err
+	})
+}
+
+func (m *Devsecops) dependencyScan(ctx context.Context, source *dagger.Directory, project *Project, scanner string) (*scanSpec, error) {
+	if err := checkScanner(scanner); err != nil {
+		return nil, err
+	}
+	if scanner != "specialized" {
+		fmt.Printf("📦 Running dependency scanning for %s with Trivy...\n", project.Language)
+		return m.trivyFsScan(source, "dependencies", "vuln", "dependency-scan.json")
+	}
+
+	fmt.Printf("📦 Running dependency scanning for %s...\n", project.Language)
 
-	switch language {
+	scan := &scanSpec{
+		name:   "dependencies",
+		report: "dependency-scan.json",
+	}
+
+	switch project.Language {
 	case "node":
-		return dag.Container().
-			From("node:20-alpine").
+		image, err := m.image("node")
+		if err != nil {
+			return nil, err
+		}
+		// npm and pnpm audit read the lock file: lock file resolution reuses
+		// the package cache
+		scan.tool = "npm-audit"
+		scan.ctr = dag.Container().
+			From(image).
+			With(packageCache(project)).
 			WithMountedDirectory("/src", source).
-			WithWorkdir("/src").
-			WithExec([]string{"sh", "-c", "npm audit --json > dependency-scan.json || true"})
+			WithWorkdir("/src")
+
+		switch project.PackageManager {
+		case "pnpm":
+			// pnpm audit reads pnpm-lock.yaml and reports in the npm 6 format
+			scan.tool = "pnpm-audit"
+			scan.ctr = scan.ctr.WithExec([]string{"corepack", "enable"})
+			scan.cmd = []string{"sh", "-c", "pnpm audit --json > dependency-scan.json || true"}
+		default:
+			// npm audit needs an npm lock file: resolve one for yarn, bun or
+			// lock-less projects
+			scan.cmd = []string{"sh", "-c", `
+if [ ! -f package-lock.json ] && [ ! -f npm-shrinkwrap.json ]; then
+  npm install --package-lock-only --ignore-scripts --no-audit --no-fund > /dev/null 2>&1 || true
+fi
+npm audit --json > dependency-scan.json || true
+`}
+		}
 
 	case "python":
-		return dag.Container().
-			From("python:3.12-slim").
+		image, err := m.image("python")
+		if err != nil {
+			return nil, err
+		}
+		// pip-audit resolves the requirements in its own environment: it
+		// does not depend on the install step of BuildPython and TestPython
+		scan.tool = "pip-audit"
+		scan.ctr = dag.Container().
+			From(image).
+			With(packageCache(project)).
 			WithMountedDirectory("/src", source).
 			WithWorkdir("/src").
-			WithExec([]string{"pip", "install", "-U", "pip", "pip-audit"}).
-			WithExec([]string{"sh", "-c", "pip-audit -r requirements.txt -f json > dependency-scan.json || true"})
+			WithExec([]string{"pip", "install", "-U", "pip", "pip-audit"})
+		scan.cmd = []string{"sh", "-c", pipAuditScript(project.PackageManager)}
 
 	case "php":
-		return dag.Container().
-			From("php:8.3-cli").
+		image, err := m.image("php")
+		if err != nil {
+			return nil, err
+		}
+		// composer audit reads composer.lock: it does not depend on the install
+		// step of BuildPhp and TestPhp
+		scan.tool = "composer-audit"
+		scan.ctr = dag.Container().
+			From(image).
+			With(packageCache(project)).
 			WithMountedDirectory("/src", source).
 			WithWorkdir("/src").
-			WithExec([]string{"sh", "-c", "curl -sS https://getcomposer.org/installer | php -- --install-dir=/usr/local/bin --filename=composer"}).
-			WithExec([]string{"sh", "-c", "composer audit --format=json > dependency-scan.json || true"})
+			WithExec([]string{"sh", "-c", "curl -sS https://getcomposer.org/installer | php -- --install-dir=/usr/local/bin --filename=composer"})
+		scan.cmd = []string{"sh", "-c", `
+if [ -f composer.lock ]; then
+  composer audit --locked --format=json > dependency-scan.json || true
+else
+  composer audit --format=json > dependency-scan.json || true
+fi
+`}
 
 	default:
-		return dag.Container().
-			From("alpine:3.20").
+		image, err := m.image("alpine")
+		if err != nil {
+			return nil, err
+		}
+		scan.tool = "none"
+		scan.ctr = dag.Container().
+			From(image).
 			WithMountedDirectory("/src", source).
-			WithWorkdir("/src").
-			WithExec([]string{"sh", "-c", "echo '{}' > dependency-scan.json"})
+			WithWorkdir("/src")
+		scan.cmd = []string{"sh", "-c", "echo '{}' > dependency-scan.json"}
 	}
+
+	return scan, nil
 }
 
-// SastScanning runs static application security testing with Semgrep
+// pipAuditScript builds the pip-audit invocation for a Python package manager.
+// Lock files pip-audit cannot read are exported to a requirements file first.
+func pipAuditScript(packageManager string) string {
+	export := ""
+	switch packageManager {
+	case "poetry":
+		export = "pip install poetry poetry-plugin-export && poetry export -f requirements.txt --without-hashes -o /tmp/requirements.txt"
+	case "uv":
+		export = "pip install uv && uv export --format requirements-txt --no-hashes -o /tmp/requirements.txt"
+	case "pipenv":
+		export = "pip install pipenv && pipenv requirements > /tmp/requirements.txt"
+	}
+
+	if export != "" {
+		return `
+set -e
+` + export + `
+pip-audit -r /tmp/requirements.txt -f json > dependency-scan.json || true
+`
+	}
+
+	// Same fallback as the dependency-scanning-specialized job
+	return `
+if [ -f requirements.txt ]; then
+  pip-audit -r requirements.txt -f json > dependency-scan.json || true
+elif [ -f pyproject.toml ] || [ -f setup.py ]; then
+  pip-audit -f json . > dependency-scan.json || true
+else
+  echo "[]" > dependency-scan.json
+fi
+`
+}
+
+// SastScanning runs static application security testing with Semgrep and/or
+// Trivy misconfiguration detection, selected like the sast and sast-semgrep
+// jobs, and returns the results and reports, whatever the outcome: gate on the
+// security policy with check
 func (m *Devsecops) SastScanning(
 	ctx context.Context,
 	// +required
 	source *dagger.Directory,
-) *dagger.Container {
+	// Scanner: "trivy" (unified, the DEVSECOPS_SECURITY_SCANNER default) or "specialized"
+	// +default="trivy"
+	scanner string,
+	// SAST tool alongside the scanner, like DEVSECOPS_SAST_TOOL: "semgrep" or "trivy"
+	// +default="semgrep"
+	sastTool string,
+	// Security policy: "strict" (fail on findings) or "permissive" (report only)
+	// +default="strict"
+	policy string,
+	// Minimum failing severity, or a DEVSECOPS_TRIVY_SEVERITY-style list (its lowest entry)
+	// +default="HIGH"
+	failSeverity string,
+	// Per-scanner overrides, e.g. "secrets=LOW", "semgrep=CRITICAL" or "dependencies=off"
+	// +optional
+	scannerSeverity []string,
+	// Baseline reports directory (e.g. exported from a run on the target branch):
+	// only findings missing from it are gated
+	// +optional
+	baseline *dagger.Directory,
+	// Baseline source (e.g. a target branch checkout) scanned like the source
+	// to build the baseline
+	// +optional
+	baselineSource *dagger.Directory,
+) (*ScanRun, error) {
+	gate, err := findings.ParsePolicy(policy, failSeverity, scannerSeverity)
+	if err != nil {
+		return nil, err
+	}
+
+	return runScans(ctx, source, nil, baseline, baselineSource, gate, func(source *dagger.Directory) ([]*scanSpec, error) {
+		return m.sastScans(source, scanner, sastTool)
+	})
+}
+
+// sastScans selects the SAST scans like the template rules: Trivy runs with
+// the trivy scanner or sastTool, Semgrep with the specialized scanner or
+// sastTool, so the defaults (trivy and semgrep) run both.
+func (m *Devsecops) sastScans(source *dagger.Directory, scanner, sastTool string) ([]*scanSpec, error) {
+	if err := checkScanner(scanner); err != nil {
+		return nil, err
+	}
+	sastTool = cmp.Or(sastTool, "semgrep")
+	if sastTool != "semgrep" && sastTool != "trivy" {
+		return nil, fmt.Errorf("unknown SAST tool %q (expected \"semgrep\" or \"trivy\")", sastTool)
+	}
+
+	var specs []*scanSpec
+	if scanner != "specialized" || sastTool == "trivy" {
+		fmt.Println("🔬 Running SAST with Trivy...")
+		spec, err := m.trivyFsScan(source, "sast", "misconfig", "sast-report.json")
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	if scanner == "specialized" || sastTool == "semgrep" {
+		spec, err := m.sastScan(source)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func (m *Devsecops) sastScan(source *dagger.Directory) (*scanSpec, error) {
 	fmt.Println("🔬 Running SAST with Semgrep...")
 
-	return dag.Container().
-		From("returntocorp/semgrep:1.97.0").
+	image, err := m.image("semgrep")
+	if err != nil {
+		return nil, err
+	}
+	ctr := dag.Container().
+		From(image).
 		WithMountedDirectory("/src", source).
-		WithWorkdir("/src").
-		WithExec([]string{
-			"semgrep", "scan",
-			"--config", "p/security-audit",
+		WithWorkdir("/src")
+	config := []string{"--config", semgrepRuleset}
+	if m.SemgrepRules != nil {
+		// Local rules need neither the registry nor metrics
+		ctr = ctr.
+			WithMountedDirectory(semgrepRulesDir, m.SemgrepRules).
+			WithEnvVariable("SEMGREP_ENABLE_VERSION_CHECK", "0")
+		config = []string{"--config", semgrepRulesDir, "--metrics", "off"}
+	}
+
+	return &scanSpec{
+		name:   "sast",
+		tool:   "semgrep",
+		report: "semgrep.json",
+		ctr:    ctr,
+		cmd: slices.Concat([]string{"semgrep", "scan"}, config, []string{
 			"--json",
 			"-o", "semgrep.json",
 			".",
-		})
+		}),
+	}, nil
 }
 
-// ContainerScanning scans a container image with Trivy
-func (m *Devsecops) ContainerScanning(
+// IacScanning scans Infrastructure as Code files for misconfigurations and
+// returns the result and report, whatever the outcome: gate on the security
+// policy with check
+func (m *Devsecops) IacScanning(
 	ctx context.Context,
 	// +required
+	source *dagger.Directory,
+	// Directory with IaC files, relative to the source (DEVSECOPS_IAC_TARGET_DIR)
+	// +default="k8s"
+	targetDir string,
+	// Scanner: "trivy" (Trivy config) or "specialized" (Kubeconform, Kube-Score and Polaris)
+	// +default="trivy"
+	scanner string,
+	// Security policy: "strict" (fail on findings) or "permissive" (report only)
+	// +default="strict"
+	policy string,
+	// Minimum failing severity, or a DEVSECOPS_TRIVY_SEVERITY-style list (its lowest entry)
+	// +default="HIGH"
+	failSeverity string,
+	// Per-scanner overrides, e.g. "iac=CRITICAL" or "polaris=off"
+	// +optional
+	scannerSeverity []string,
+	// Baseline reports directory (e.g. exported from a run on the target branch):
+	// only findings missing from it are gated
+	// +optional
+	baseline *dagger.Directory,
+	// Baseline source (e.g. a target branch checkout) scanned like the source
+	// to build the baseline
+	// +optional
+	baselineSource *dagger.Directory,
+) (*ScanRun, error) {
+	gate, err := findings.ParsePolicy(policy, failSeverity, scannerSeverity)
+	if err != nil {
+		return nil, err
+	}
+
+	return runScans(ctx, source, nil, baseline, baselineSource, gate, func(source *dagger.Directory) ([]*scanSpec, error) {
+		spec, err := m.iacScan(source, targetDir, scanner)
+		return []*scanSpec{spec}, err
+	})
+}
+
+// iacScanTargetCheck exits successfully without a report when the IaC target
+// directory is missing, like the iac-security jobs.
+const iacScanTargetCheck = `if [ ! -d "${TARGET_DIR}" ]; then
+  echo "No IaC target dir '${TARGET_DIR}' found. Set DEVSECOPS_IAC_TARGET_DIR or disable DEVSECOPS_ENABLE_IAC_SCAN."
+  exit 0
+fi
+`
+
+func (m *Devsecops) iacScan(source *dagger.Directory, targetDir, scanner string) (*scanSpec, error) {
+	targetDir = "./" + strings.Trim(cmp.Or(targetDir, "k8s"), "/")
+
+	switch scanner {
+	case "", "trivy":
+		fmt.Printf("🏗️  Scanning IaC in %s with Trivy...\n", targetDir)
+
+		ctr, err := m.trivyContainer()
+		if err != nil {
+			return nil, err
+		}
+		return &scanSpec{
+			name:   "iac",
+			tool:   "trivy",
+			report: "iac-report.json",
+			ctr: ctr.
+				WithMountedDirectory("/src", source).
+				WithWorkdir("/src").
+				WithEnvVariable("TARGET_DIR", targetDir),
+			cmd: []string{"sh", "-c", iacScanTargetCheck + `trivy config \
+  --format json \
+  --output iac-report.json \
+  "${TARGET_DIR}"
+`},
+		}, nil
+
+	case "specialized":
+		if m.tools().RequireDigests {
+			// The binaries are downloaded from their latest releases, outside
+			// of the image configuration
+			return nil, fmt.Errorf("the specialized IaC scan downloads Kubeconform, Kube-Score and Polaris from their latest releases, which cannot be pinned by digest: use the trivy IaC scanner")
+		}
+		fmt.Printf("🏗️  Scanning IaC in %s with Kubeconform, Kube-Score and Polaris...\n", targetDir)
+
+		image, err := m.image("alpine")
+		if err != nil {
+			return nil, err
+		}
+		return &scanSpec{
+			name:   "iac",
+			tool:   "polaris",
+			report: "polaris.json",
+			ctr: dag.Container().
+				From(image).
+				WithExec([]string{"apk", "add", "--no-cache", "bash", "curl"}).
+				WithExec([]string{"sh", "-c", `set -e
+curl -sSL -o /usr/local/bin/kubeconform https://github.com/yannh/kubeconform/releases/latest/download/kubeconform-linux-amd64
+curl -sSL -o /usr/local/bin/kubescore https://github.com/zegl/kube-score/releases/latest/download/kube-score_linux_amd64
+curl -sSL -o /usr/local/bin/polaris https://github.com/FairwindsOps/polaris/releases/latest/download/polaris_linux_amd64
+chmod +x /usr/local/bin/kubeconform /usr/local/bin/kubescore /usr/local/bin/polaris
+`}).
+				WithMountedDirectory("/src", source).
+				WithWorkdir("/src").
+				WithEnvVariable("TARGET_DIR", targetDir),
+			cmd: []string{"sh", "-c", "set -e\n" + iacScanTargetCheck + `kubeconform -summary -strict "${TARGET_DIR}" || true
+find "${TARGET_DIR}" -name '*.yaml' -o -name '*.yml' | head -n 50 | xargs -I{} sh -c 'kubescore score "{}" || true'
+polaris audit --audit-path "${TARGET_DIR}" --format json > polaris.json || true
+`},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown IaC scanner %q (expected \"trivy\" or \"specialized\")", scanner)
+	}
+}
+
+// dastServiceAlias is the hostname a service scanned by DastScanning is bound to
+const dastServiceAlias = "app"
+
+// serviceURL returns the URL of a service bound to alias, on port or on its
+// first exposed port
+func serviceURL(ctx context.Context, service *dagger.Service, alias string, port int) (string, error) {
+	if port == 0 {
+		endpoint, err := service.Endpoint(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve the service port: %w", err)
+		}
+		if _, p, ok := strings.Cut(endpoint, ":"); ok {
+			port, _ = strconv.Atoi(p)
+		}
+		if port == 0 {
+			return "", fmt.Errorf("service exposes no port, set --service-port")
+		}
+	}
+	return fmt.Sprintf("http://%s:%d", alias, port), nil
+}
+
+// DastResult is the outcome of an OWASP ZAP baseline scan
+type DastResult struct {
+	// Scanned URL
+	TargetUrl string
+	// passed, warning (ZAP warnings, other ZAP failures, or alerts under a
+	// permissive policy) or failed (alerts under a strict policy)
+	Status string
+	// Exit code of zap-baseline.py: 1 for alerts, 2 for warnings, 3 for any
+	// other failure
+	ExitCode int
+	// Finding counts by severity, from zap.json
+	Findings *SeverityCounts
+	// Last lines of the ZAP output
+	Output string
+	// zap.json and zap.html, like the dast-zap job artifacts
+	Reports *dagger.Directory
+}
+
+// Check returns an error with the tail of the ZAP output when the scan failed
+// the policy, to gate a pipeline on it
+func (r *DastResult) Check() error {
+	if r.Status != "failed" {
+		return nil
+	}
+	return fmt.Errorf("DAST found security alerts in strict mode:\n%s", r.Output)
+}
+
+// DastScanning runs an OWASP ZAP baseline scan against a running application
+// and returns the result with the zap directory holding zap.json and
+// zap.html, like the dast-zap job, whatever the outcome: gate on the policy
+// with check. Scan a deployed environment with --target-url, or a service
+// started by Dagger with --service, which is reachable at http://app:<port>.
+func (m *Devsecops) DastScanning(
+	ctx context.Context,
+	// URL to scan (DEVSECOPS_STAGING_URL); defaults to the root of the service
+	// +optional
+	targetUrl string,
+	// Application to scan, bound as "app"
+	// +optional
+	service *dagger.Service,
+	// Port of the service (defaults to its first exposed port)
+	// +optional
+	servicePort int,
+	// Security policy: "strict" fails on ZAP alerts, "permissive" only reports them
+	// +default="strict"
+	policy string,
+) (*DastResult, error) {
+	// ZAP decides what an alert is, so only the policy mode applies
+	gate, err := findings.ParsePolicy(policy, string(findings.SeverityHigh), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := m.image("zap")
+	if err != nil {
+		return nil, err
+	}
+	ctr := dag.Container().From(image)
+
+	if service != nil {
+		serviceUrl, err := serviceURL(ctx, service, dastServiceAlias, servicePort)
+		if err != nil {
+			return nil, err
+		}
+		ctr = ctr.WithServiceBinding(dastServiceAlias, service)
+		targetUrl = cmp.Or(targetUrl, serviceUrl)
+	}
+	if targetUrl == "" {
+		return nil, fmt.Errorf("a target URL or a service is required for DAST")
+	}
+
+	fmt.Printf("🕷️  Running OWASP ZAP baseline scan against %s...\n", targetUrl)
+
+	// zap-baseline.py writes its reports relative to /zap/wrk
+	ctr = ctr.
+		WithUser("root").
+		WithExec([]string{"sh", "-c", "mkdir -p /zap/wrk/zap && chown -R zap /zap/wrk"}).
+		WithUser("zap").
+		WithWorkdir("/zap/wrk").
+		WithExec(
+			[]string{"zap-baseline.py", "-t", targetUrl, "-J", "zap/zap.json", "-r", "zap/zap.html"},
+			dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny},
+		)
+
+	exitCode, err := ctr.ExitCode(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ZAP baseline scan failed to run: %w", err)
+	}
+
+	result := &DastResult{
+		TargetUrl: targetUrl,
+		Status:    "passed",
+		ExitCode:  exitCode,
+		Findings:  &SeverityCounts{},
+		Reports:   ctr.Directory("/zap/wrk/zap"),
+	}
+	if stdout, err := ctr.Stdout(ctx); err == nil {
+		result.Output = tail(stdout, maxListedViolations)
+	}
+	if contents, err := result.Reports.File("zap.json").Contents(ctx); err == nil {
+		if parsed, _, err := findings.Parse("zap/zap.json", []byte(contents)); err == nil {
+			result.Findings = newSeverityCounts(parsed)
+		}
+	}
+
+	// Exit code 1 means alerts, 2 warnings and 3 any other failure; only
+	// alerts fail the scan, and only under a strict policy
+	switch exitCode {
+	case 0:
+		fmt.Println("✅ ZAP baseline scan passed")
+	case 1:
+		if gate.Strict() {
+			result.Status = "failed"
+			fmt.Println("❌ DAST found security alerts in strict mode, see check")
+			break
+		}
+		result.Status = "warning"
+		fmt.Println("⚠️  DAST found security alerts (permissive policy)")
+	case 2:
+		result.Status = "warning"
+		fmt.Println("⚠️  ZAP baseline scan passed with warnings")
+	default:
+		result.Status = "warning"
+		fmt.Printf("⚠️  ZAP baseline scan exited with code %d\n", exitCode)
+	}
+
+	return result, nil
+}
+
+// ContainerScanning scans a container image with Trivy like the
+// container-security-scan job and returns the scan result with the trivy.json
+// report, whatever the outcome: gate on the vulnerabilities with check. The
+// image is a registry reference (imageName), a container built with Dagger
+// (image) or a docker/OCI image tarball (tarball), scanned without any registry.
+func (m *Devsecops) ContainerScanning(
+	ctx context.Context,
+	// Image repository (DEVSECOPS_IMAGE_NAME)
+	// +optional
 	imageName string,
+	// Image tag (DEVSECOPS_IMAGE_TAG)
 	// +default="latest"
 	imageTag string,
-) *dagger.Container {
-	fmt.Printf("🐳 Scanning container %s:%s with Trivy...\n", imageName, imageTag)
+	// Sub-image appended to the repository, e.g. "staging" (DEVSECOPS_CONTAINER_IMAGE_SUFFIX)
+	// +optional
+	imageSuffix string,
+	// Severities to report (DEVSECOPS_TRIVY_SEVERITY)
+	// +default="CRITICAL,HIGH"
+	severity string,
+	// Exit code when vulnerabilities are found: 0 to warn, 1 to fail check (DEVSECOPS_TRIVY_EXIT_CODE)
+	// +default=1
+	exitCode int,
+	// Trivy scanners, e.g. "vuln,secret" (DEVSECOPS_TRIVY_SCANNERS; Trivy default if empty)
+	// +optional
+	scanners string,
+	// Trivy ignore file (DEVSECOPS_TRIVY_IGNOREFILE)
+	// +optional
+	ignoreFile *dagger.File,
+	// Skip vulnerabilities without a fix (DEVSECOPS_TRIVY_IGNORE_UNFIXED)
+	// +optional
+	ignoreUnfixed bool,
+	// Allow insecure registry connections (DEVSECOPS_TRIVY_NON_SSL)
+	// +optional
+	nonSsl bool,
+	// Registry username (CI_REGISTRY_USER)
+	// +optional
+	registryUsername string,
+	// Registry password or token (CI_REGISTRY_PASSWORD)
+	// +optional
+	registryPassword *dagger.Secret,
+	// Container to scan instead of a registry image
+	// +optional
+	image *dagger.Container,
+	// Docker or OCI image tarball to scan instead of a registry image
+	// +optional
+	tarball *dagger.File,
+	// Platform to scan in a multi-arch image, e.g. "linux/arm64"
+	// +optional
+	platform string,
+) (*ScanResult, error) {
+	sources := 0
+	for _, set := range []bool{imageName != "", image != nil, tarball != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("exactly one of --image-name, --image or --tarball is required")
+	}
 
-	imageRef := fmt.Sprintf("%s:%s", imageName, imageTag)
+	// Trivy already reports the listed severities only: they all fail the
+	// scan, unless vulnerabilities only warn
+	mode := findings.PolicyStrict
+	if exitCode == 0 {
+		mode = findings.PolicyPermissive
+	}
+	policy, err := findings.ParsePolicy(mode, severity, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid severity: %w", err)
+	}
 
-	return dag.Container().
-		From("aquasec/trivy:0.58.1").
-		WithExec([]string{
-			"trivy", "image",
-			"--severity", "CRITICAL,HIGH",
-			"--exit-code", "0",
+	ctr, err := m.trivyClient()
+	if err != nil {
+		return nil, err
+	}
+	ctr = ctr.WithWorkdir("/src")
+
+	fmt.Println("================================================")
+	fmt.Println("🐳 Scanning container image for vulnerabilities")
+
+	// target holds the image arguments of trivy image
+	var target []string
+	var imageRef string
+	switch {
+	case imageName != "":
+		imageRepo := imageName
+		if imageSuffix != "" {
+			imageRepo += "/" + imageSuffix
+		}
+		imageRef = fmt.Sprintf("%s:%s", imageRepo, imageTag)
+		target = []string{"--image-src", "remote", imageRef}
+
+		fmt.Printf("Registry: %s\n", imageRepo)
+		fmt.Printf("Tag: %s\n", imageTag)
+		fmt.Printf("Full reference: %s\n", imageRef)
+	default:
+		if image != nil {
+			imageRef = "local container"
+			tarball = image.AsTarball()
+		} else {
+			imageRef = "image tarball"
+		}
+		ctr = ctr.WithMountedFile("/work/image.tar", tarball)
+		target = []string{"--input", "/work/image.tar"}
+
+		fmt.Printf("Input: %s\n", imageRef)
+	}
+	fmt.Println("================================================")
+	if registryUsername != "" {
+		ctr = ctr.WithEnvVariable("TRIVY_USERNAME", registryUsername)
+	}
+	if registryPassword != nil {
+		ctr = ctr.WithSecretVariable("TRIVY_PASSWORD", registryPassword)
+	}
+
+	flags := []string{
+		"--severity", severity,
+		"--insecure=" + strconv.FormatBool(nonSsl),
+	}
+	if platform != "" {
+		flags = append(flags, "--platform", platform)
+	}
+	if scanners != "" {
+		flags = append(flags, "--scanners", scanners)
+	}
+	if ignoreFile != nil {
+		ctr = ctr.WithMountedFile("/work/.trivyignore", ignoreFile)
+		flags = append(flags, "--ignorefile", "/work/.trivyignore")
+	}
+	if ignoreUnfixed {
+		flags = append(flags, "--ignore-unfixed")
+	}
+
+	spec := &scanSpec{
+		name:   "container",
+		tool:   "trivy",
+		report: "trivy.json",
+		ctr:    ctr,
+		cmd: slices.Concat([]string{"trivy", "image"}, flags, []string{
+			"--exit-code", strconv.Itoa(exitCode),
 			"--format", "json",
 			"--output", "trivy.json",
-			imageRef,
-		})
+		}, target),
+	}
+	if spec.vulnDb, err = m.trivyDbMetadata(); err != nil {
+		return nil, err
+	}
+	result, scan := spec.run(ctx, policy)
+	if result.Status == "error" {
+		fmt.Printf("❌ trivy image exited with code %d without a usable report, see check\n", result.ExitCode)
+		return result, nil
+	}
+
+	if updatedAt, err := trivyDbUpdatedAt(ctx, spec.vulnDb); err == nil {
+		printDbAge(updatedAt)
+	}
+
+	// Also print the table format for easier reading, reusing the downloaded DB
+	table, err := scan.
+		WithExec(
+			slices.Concat([]string{"trivy", "image"}, flags, []string{"--format", "table"}, target),
+			dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny},
+		).
+		Stdout(ctx)
+	if err == nil {
+		fmt.Println()
+		fmt.Println("Vulnerability Summary:")
+		fmt.Println("================================================")
+		fmt.Println(table)
+	}
+
+	if len(result.Violations) > 0 {
+		fmt.Printf("❌ trivy found %d %s vulnerabilities in %s, see check\n", len(result.Violations), severity, imageRef)
+	}
+	return result, nil
 }
 
 // Build builds a Node.js application
@@ -167,72 +1272,211 @@ func (m *Devsecops) BuildNode(
 	ctx context.Context,
 	// +required
 	source *dagger.Directory,
-	// +default="20"
+	// Node.js version (defaults to the configured node image, node:20-alpine)
+	// +optional
 	nodeVersion string,
-	// +default="npm"
+	// Package manager (auto, npm, pnpm, yarn, bun)
+	// +default="auto"
 	packageManager string,
 ) (*dagger.Directory, error) {
+	project, err := resolveProject(ctx, source, "node", packageManager)
+	if err != nil {
+		return nil, err
+	}
+	packageManager = project.PackageManager
+
 	fmt.Printf("🔨 Building Node.js project with %s...\n", packageManager)
 
-	container := dag.Container().
-		From(fmt.Sprintf("node:%s-alpine", nodeVersion)).
-		WithMountedDirectory("/src", source).
-		WithWorkdir("/src").
-		WithExec([]string{"corepack", "enable"})
+	container, err := m.nodeDependencies(source, project, nodeVersion)
+	if err != nil {
+		return nil, err
+	}
 
 	switch packageManager {
 	case "pnpm":
-		container = container.
-			WithExec([]string{"pnpm", "install", "--frozen-lockfile"}).
-			WithExec([]string{"pnpm", "build"})
+		container = container.WithExec([]string{"pnpm", "build"})
 	case "yarn":
-		container = container.
-			WithExec([]string{"yarn", "install", "--frozen-lockfile"}).
-			WithExec([]string{"yarn", "build"})
+		container = container.WithExec([]string{"yarn", "build"})
+	case "bun":
+		container = container.WithExec([]string{"bun", "run", "build"})
 	default:
-		container = container.
-			WithExec([]string{"npm", "ci"}).
-			WithExec([]string{"npm", "run", "build"})
+		container = container.WithExec([]string{"npm", "run", "build"})
 	}
 
 	return container.Directory("/src"), nil
 }
 
-// TestNode runs Node.js tests
+// TestNode runs Node.js tests and returns their JUnit and coverage reports.
+// Reports are collected wherever the test runner writes them (junit*.xml,
+// coverage/lcov.info, coverage-summary.json, cobertura-coverage.xml, ...).
 func (m *Devsecops) TestNode(
 	ctx context.Context,
 	// +required
 	source *dagger.Directory,
-	// +default="20"
+	// Node.js version (defaults to the configured node image, node:20-alpine)
+	// +optional
 	nodeVersion string,
-	// +default="npm"
+	// Package manager (auto, npm, pnpm, yarn, bun)
+	// +default="auto"
 	packageManager string,
-) error {
+	// Minimum line coverage percentage (0 disables the gate)
+	// +optional
+	minCoverage float64,
+) (*TestResult, error) {
+	project, err := resolveProject(ctx, source, "node", packageManager)
+	if err != nil {
+		return nil, err
+	}
+	packageManager = project.PackageManager
+
 	fmt.Printf("🧪 Running Node.js tests with %s...\n", packageManager)
 
-	container := dag.Container().
-		From(fmt.Sprintf("node:%s-alpine", nodeVersion)).
-		WithMountedDirectory("/src", source).
-		WithWorkdir("/src").
-		WithExec([]string{"corepack", "enable"})
+	container, err := m.nodeDependencies(source, project, nodeVersion)
+	if err != nil {
+		return nil, err
+	}
 
+	var cmd []string
 	switch packageManager {
 	case "pnpm":
-		container = container.
-			WithExec([]string{"pnpm", "install", "--frozen-lockfile"}).
-			WithExec([]string{"pnpm", "test", "--", "--ci"})
+		cmd = []string{"pnpm", "test", "--", "--ci"}
 	case "yarn":
-		container = container.
-			WithExec([]string{"yarn", "install", "--frozen-lockfile"}).
-			WithExec([]string{"yarn", "test"})
+		cmd = []string{"yarn", "test"}
+	case "bun":
+		cmd = []string{"bun", "run", "test"}
 	default:
-		container = container.
-			WithExec([]string{"npm", "ci"}).
-			WithExec([]string{"npm", "test"})
+		cmd = []string{"npm", "test"}
 	}
 
-	_, err := container.Sync(ctx)
-	return err
+	return runTests(ctx, container, packageManager, cmd, minCoverage)
+}
+
+// BuildPython builds a Python application like the build:python job: a
+// package build with pyproject.toml, or a dependency install with
+// requirements.txt. The returned source holds dist/ for package builds.
+func (m *Devsecops) BuildPython(
+	ctx context.Context,
+	// +required
+	source *dagger.Directory,
+	// Python version (defaults to the configured python image, python:3.12-slim)
+	// +optional
+	pythonVersion string,
+) (*dagger.Directory, error) {
+	fmt.Println("🔨 Building Python project...")
+
+	project, err := resolveProject(ctx, source, "python", "auto")
+	if err != nil {
+		return nil, err
+	}
+	container, err := m.pythonDependencies(source, project, pythonVersion)
+	if err != nil {
+		return nil, err
+	}
+	container = container.
+		WithExec([]string{"sh", "-c", `
+if [ -f "pyproject.toml" ]; then
+  pip install -U build
+  python -m build
+elif [ ! -f "requirements.txt" ]; then
+  echo "No requirements.txt / pyproject.toml found. Skipping dependency install."
+fi
+`})
+
+	return container.Directory("/src"), nil
+}
+
+// TestPython runs Python tests with pytest like the test:python job and
+// returns the JUnit (junit.xml) and Cobertura coverage (coverage.xml) reports
+func (m *Devsecops) TestPython(
+	ctx context.Context,
+	// +required
+	source *dagger.Directory,
+	// Python version (defaults to the configured python image, python:3.12-slim)
+	// +optional
+	pythonVersion string,
+	// Minimum line coverage percentage (0 disables the gate)
+	// +optional
+	minCoverage float64,
+) (*TestResult, error) {
+	fmt.Println("🧪 Running Python tests with pytest...")
+
+	project, err := resolveProject(ctx, source, "python", "auto")
+	if err != nil {
+		return nil, err
+	}
+	container, err := m.pythonDependencies(source, project, pythonVersion)
+	if err != nil {
+		return nil, err
+	}
+	container = container.
+		WithExec([]string{"pip", "install", "pytest", "pytest-cov"})
+
+	return runTests(ctx, container, "pytest",
+		[]string{"pytest", "-q", "--junitxml=junit.xml", "--cov=.", "--cov-report=xml:coverage.xml"},
+		minCoverage)
+}
+
+// BuildPhp installs the Composer dependencies of a PHP application like the
+// build:php job. The returned source holds vendor/.
+func (m *Devsecops) BuildPhp(
+	ctx context.Context,
+	// +required
+	source *dagger.Directory,
+	// PHP version (defaults to the configured php image, php:8.3-cli)
+	// +optional
+	phpVersion string,
+) (*dagger.Directory, error) {
+	fmt.Println("🔨 Building PHP project with Composer...")
+
+	project, err := resolveProject(ctx, source, "php", "composer")
+	if err != nil {
+		return nil, err
+	}
+	container, err := m.phpDependencies(source, project, phpVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return container.Directory("/src"), nil
+}
+
+// TestPhp runs PHPUnit tests like the test:phpunit job, with Xdebug coverage,
+// and returns the Clover coverage report (coverage.xml)
+func (m *Devsecops) TestPhp(
+	ctx context.Context,
+	// +required
+	source *dagger.Directory,
+	// PHP version (defaults to the configured php image, php:8.3-cli)
+	// +optional
+	phpVersion string,
+	// Minimum line coverage percentage (0 disables the gate)
+	// +optional
+	minCoverage float64,
+) (*TestResult, error) {
+	fmt.Println("🧪 Running PHP tests with PHPUnit...")
+
+	project, err := resolveProject(ctx, source, "php", "composer")
+	if err != nil {
+		return nil, err
+	}
+	container, err := m.phpDependencies(source, project, phpVersion)
+	if err != nil {
+		return nil, err
+	}
+	container = container.
+		WithExec([]string{"sh", "-c", "pecl install xdebug && docker-php-ext-enable xdebug"}).
+		WithEnvVariable("XDEBUG_MODE", "coverage")
+
+	return runTests(ctx, container, "PHPUnit", []string{"sh", "-c", `
+if [ -f "vendor/bin/phpunit" ]; then
+  vendor/bin/phpunit --coverage-clover coverage.xml
+elif [ -f "bin/phpunit" ]; then
+  php bin/phpunit --coverage-clover coverage.xml
+else
+  echo "PHPUnit not found in vendor/bin/phpunit or bin/phpunit"
+  exit 1
+fi
+`}, minCoverage)
 }
 
 // ValidateYaml validates GitLab CI YAML syntax
@@ -243,8 +1487,12 @@ func (m *Devsecops) ValidateYaml(
 ) (string, error) {
 	fmt.Println("✅ Validating GitLab CI YAML syntax...")
 
+	image, err := m.image("alpine")
+	if err != nil {
+		return "", err
+	}
 	output, err := dag.Container().
-		From("alpine:3.20").
+		From(image).
 		WithExec([]string{"apk", "add", "--no-cache", "yq"}).
 		WithMountedFile("/ci.yml", yamlFile).
 		WithExec([]string{"yq", "eval", "/ci.yml"}).
@@ -393,8 +1641,11 @@ echo "To test with a real Dependency-Track instance, use:"
 echo "  dagger call dtrack-upload --source=. --dtrack-url=<URL> --dtrack-api-key=env:DTRACK_KEY"
 `
 
-	container := dag.Container().
-		From("aquasec/trivy:0.58.1").
+	trivy, err := m.trivyContainer()
+	if err != nil {
+		return "", err
+	}
+	container := trivy.
 		WithMountedDirectory("/src", source).
 		WithWorkdir("/src").
 		WithExec([]string{"apk", "add", "--no-cache", "curl", "jq", "coreutils"}).
@@ -479,8 +1730,11 @@ else
 fi
 `
 
-	container := dag.Container().
-		From("aquasec/trivy:0.58.1").
+	trivy, err := m.trivyContainer()
+	if err != nil {
+		return "", err
+	}
+	container := trivy.
 		WithMountedDirectory("/src", source).
 		WithWorkdir("/src").
 		WithExec([]string{"apk", "add", "--no-cache", "curl", "jq", "coreutils"}).
@@ -943,8 +2197,11 @@ fi
 echo "All AI Reporting tests passed!"
 `
 
-	container := dag.Container().
-		From("aquasec/trivy:0.58.1").
+	trivy, err := m.trivyContainer()
+	if err != nil {
+		return "", err
+	}
+	container := trivy.
 		WithMountedDirectory("/src", source).
 		WithWorkdir("/src").
 		WithExec([]string{"apk", "add", "--no-cache", "curl", "jq", "coreutils", "grep"})
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"dagger/devsecops/internal/dagger"
+	"fmt"
+	"path"
+	"time"
+)
+
+const (
+	// semgrepRuleset is the registry ruleset of the sast-semgrep job
+	semgrepRuleset = "p/security-audit"
+	// semgrepRegistryURL serves registry rulesets as a rules file
+	semgrepRegistryURL = "https://semgrep.dev/c/"
+	// semgrepRulesDir is where local Semgrep rules are mounted
+	semgrepRulesDir = "/rules"
+	// staleDbAge is the vulnerability DB age reported as stale
+	staleDbAge = 7 * 24 * time.Hour
+)
+
+// dbAge formats a DB age in days and hours (e.g. "2d4h")
+func dbAge(age time.Duration) string {
+	hours := int(age.Hours())
+	return fmt.Sprintf("%dd%dh", hours/24, hours%24)
+}
+
+// printDbAge prints the build time and age of a vulnerability DB, flagging
+// stale DBs
+func printDbAge(updatedAt time.Time) {
+	age := time.Since(updatedAt)
+	fmt.Printf("Vulnerability DB: updated %s (%s old)\n", updatedAt.UTC().Format(time.RFC3339), dbAge(age))
+	if age > staleDbAge {
+		fmt.Printf("⚠️  The vulnerability DB is older than %s: refresh it with fetch-databases\n", dbAge(staleDbAge))
+	}
+}
+
+// FetchDatabases downloads the Trivy vulnerability and Java DBs and the
+// Semgrep rules of the sast-semgrep job on a connected machine, for air-gapped
+// runs. The bundle holds trivy/ (the Trivy cache) and semgrep/ (the rules):
+//
+//	dagger call fetch-databases export --path=./offline-db
+//	dagger call --trivy-db=./offline-db/trivy --semgrep-rules=./offline-db/semgrep test --source=.
+func (m *Devsecops) FetchDatabases(ctx context.Context) (*dagger.Directory, error) {
+	trivyImage, err := m.image("trivy")
+	if err != nil {
+		return nil, err
+	}
+	alpineImage, err := m.image("alpine")
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("📥 Downloading the Trivy vulnerability and Java DBs...")
+
+	trivy := dag.Container().
+		From(trivyImage).
+		WithEnvVariable("TRIVY_CACHE_DIR", trivyCacheDir).
+		WithExec([]string{"trivy", "image", "--download-db-only"}).
+		WithExec([]string{"trivy", "image", "--download-java-db-only"})
+	updatedAt, err := trivyDbUpdatedAt(ctx, trivy.File(trivyCacheDir+"/db/metadata.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the Trivy DBs: %w", err)
+	}
+	printDbAge(updatedAt)
+
+	fmt.Printf("📥 Downloading the %s Semgrep rules...\n", semgrepRuleset)
+
+	rulesFile := path.Join(semgrepRulesDir, path.Base(semgrepRuleset)+".yml")
+	rules := dag.Container().
+		From(alpineImage).
+		WithExec([]string{"apk", "add", "--no-cache", "curl"}).
+		WithExec([]string{"curl", "-fsSL", "--create-dirs", "-o", rulesFile, semgrepRegistryURL + semgrepRuleset}).
+		Directory(semgrepRulesDir)
+	if _, err := rules.Sync(ctx); err != nil {
+		return nil, fmt.Errorf("failed to download the Semgrep rules: %w", err)
+	}
+
+	cache := trivy.Directory(trivyCacheDir)
+	return dag.Directory().
+		WithDirectory("trivy/db", cache.Directory("db")).
+		WithDirectory("trivy/java-db", cache.Directory("java-db")).
+		WithDirectory("semgrep", rules), nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/devsecops/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	// perfServiceAlias is the hostname a service tested by PerfTest is bound to
+	perfServiceAlias = "app"
+	// k6SummaryPath is where k6 exports its end-of-test summary
+	k6SummaryPath = "/tmp/k6-summary.json"
+	// k6ThresholdsExitCode is the k6 exit code of a run crossing thresholds
+	k6ThresholdsExitCode = 99
+)
+
+// PerfResult is the outcome of a k6 performance test
+type PerfResult struct {
+	// passed or failed (thresholds crossed)
+	Status string
+	// Exit code of k6 (99 when thresholds are crossed)
+	ExitCode int
+	// Number of thresholds of the script
+	Thresholds int
+	// Crossed thresholds, as "metric: threshold"
+	FailedThresholds []string
+	// End-of-test summary exported by k6 (--summary-export)
+	Summary *dagger.File
+	// Markdown table of the main metrics and thresholds, for the pipeline summary
+	Markdown string
+}
+
+// k6Summary is the end-of-test summary of k6 --summary-export
+type k6Summary struct {
+	Metrics map[string]k6Metric `json:"metrics"`
+}
+
+// k6Metric holds the values of a metric: counts and rates for counters,
+// passes and fails for rates, statistics for trends. Thresholds map to true
+// when crossed.
+type k6Metric struct {
+	Count      *float64        `json:"count"`
+	Rate       *float64        `json:"rate"`
+	Passes     *float64        `json:"passes"`
+	Fails      *float64        `json:"fails"`
+	Value      *float64        `json:"value"`
+	Avg        *float64        `json:"avg"`
+	Med        *float64        `json:"med"`
+	Max        *float64        `json:"max"`
+	P90        *float64        `json:"p(90)"`
+	P95        *float64        `json:"p(95)"`
+	Thresholds map[string]bool `json:"thresholds"`
+}
+
+// PerfTest runs a k6 script of the source against a URL or a service. The
+// script gets the URL in BASE_URL (__ENV.BASE_URL). The result is returned
+// whatever the outcome: Check fails when a threshold of the script is crossed.
+func (m *Devsecops) PerfTest(
+	ctx context.Context,
+	// +required
+	source *dagger.Directory,
+	// k6 script, relative to the source
+	// +default="perf/load-test.js"
+	script string,
+	// URL to test (DEVSECOPS_STAGING_URL); defaults to the root of the service
+	// +optional
+	targetUrl string,
+	// Application to test, bound as "app"
+	// +optional
+	service *dagger.Service,
+	// Port of the service (defaults to its first exposed port)
+	// +optional
+	servicePort int,
+) (*PerfResult, error) {
+	image, err := m.image("k6")
+	if err != nil {
+		return nil, err
+	}
+	ctr := dag.Container().From(image)
+
+	if service != nil {
+		serviceUrl, err := serviceURL(ctx, service, perfServiceAlias, servicePort)
+		if err != nil {
+			return nil, err
+		}
+		ctr = ctr.WithServiceBinding(perfServiceAlias, service)
+		targetUrl = cmp.Or(targetUrl, serviceUrl)
+	}
+	if targetUrl == "" {
+		return nil, fmt.Errorf("a target URL or a service is required for performance tests")
+	}
+
+	fmt.Printf("🚀 Running k6 script %s against %s...\n", script, targetUrl)
+
+	ctr = ctr.
+		WithMountedDirectory("/src", source).
+		WithWorkdir("/src").
+		WithExec(
+			[]string{"k6", "run", "--no-color", "--summary-export", k6SummaryPath, "-e", "BASE_URL=" + targetUrl, script},
+			dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny},
+		)
+
+	exitCode, err := ctr.ExitCode(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("k6 failed to run: %w", err)
+	}
+	if exitCode != 0 && exitCode != k6ThresholdsExitCode {
+		stderr, _ := ctr.Stderr(ctx)
+		return nil, fmt.Errorf("k6 failed with exit code %d:\n%s", exitCode, tail(stderr, maxListedViolations))
+	}
+
+	summaryFile := ctr.File(k6SummaryPath)
+	contents, err := summaryFile.Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("k6 exported no summary: %w", err)
+	}
+	var summary k6Summary
+	if err := json.Unmarshal([]byte(contents), &summary); err != nil {
+		return nil, fmt.Errorf("invalid k6 summary: %w", err)
+	}
+
+	result := &PerfResult{
+		Status:   "passed",
+		ExitCode: exitCode,
+		Summary:  summaryFile,
+		Markdown: summary.markdown(targetUrl),
+	}
+	for _, name := range summary.metricNames() {
+		for _, threshold := range slices.Sorted(maps.Keys(summary.Metrics[name].Thresholds)) {
+			result.Thresholds++
+			if summary.Metrics[name].Thresholds[threshold] {
+				result.FailedThresholds = append(result.FailedThresholds, name+": "+threshold)
+			}
+		}
+	}
+
+	// k6 also exits with 99 when thresholds abort the test early
+	if exitCode == k6ThresholdsExitCode || len(result.FailedThresholds) > 0 {
+		result.Status = "failed"
+		fmt.Printf("❌ %d of %d k6 threshold(s) crossed, see check\n", len(result.FailedThresholds), result.Thresholds)
+		return result, nil
+	}
+	fmt.Printf("✅ k6 thresholds passed (%d)\n", result.Thresholds)
+	return result, nil
+}
+
+// Check returns an error with the crossed thresholds when the performance
+// test failed, to gate a pipeline on it
+func (r *PerfResult) Check() error {
+	if r.Status != "failed" {
+		return nil
+	}
+	lines := append([]string{"k6 thresholds crossed:"}, listed(r.FailedThresholds)...)
+	return fmt.Errorf("%s", strings.Join(lines, "\n"))
+}
+
+// metricNames returns the metric names of the summary in alphabetical order
+func (s *k6Summary) metricNames() []string {
+	return slices.Sorted(maps.Keys(s.Metrics))
+}
+
+// markdown renders the main HTTP metrics and the thresholds of the summary
+// as tables
+func (s *k6Summary) markdown(targetUrl string) string {
+	var b strings.Builder
+	b.WriteString("## Performance Test (k6)\n\n")
+	fmt.Fprintf(&b, "- **Target**: %s\n\n", targetUrl)
+
+	b.WriteString("| Metric | Value |\n|--------|-------|\n")
+	if reqs, ok := s.Metrics["http_reqs"]; ok && reqs.Count != nil {
+		fmt.Fprintf(&b, "| Requests | %.0f (%.1f/s) |\n", *reqs.Count, deref(reqs.Rate))
+	}
+	if failed, ok := s.Metrics["http_req_failed"]; ok && failed.Value != nil {
+		fmt.Fprintf(&b, "| Failed requests | %.2f%% |\n", *failed.Value*100)
+	}
+	if duration, ok := s.Metrics["http_req_duration"]; ok && duration.Avg != nil {
+		fmt.Fprintf(&b, "| Request duration | avg %.0f ms, med %.0f ms, p(90) %.0f ms, p(95) %.0f ms, max %.0f ms |\n",
+			*duration.Avg, deref(duration.Med), deref(duration.P90), deref(duration.P95), deref(duration.Max))
+	}
+	if checks, ok := s.Metrics["checks"]; ok && checks.Value != nil {
+		fmt.Fprintf(&b, "| Checks | %.2f%% (%.0f of %.0f) |\n",
+			*checks.Value*100, deref(checks.Passes), deref(checks.Passes)+deref(checks.Fails))
+	}
+	if iterations, ok := s.Metrics["iterations"]; ok && iterations.Count != nil {
+		fmt.Fprintf(&b, "| Iterations | %.0f |\n", *iterations.Count)
+	}
+
+	var rows []string
+	for _, name := range s.metricNames() {
+		thresholds := s.Metrics[name].Thresholds
+		for _, threshold := range slices.Sorted(maps.Keys(thresholds)) {
+			status := "✅ passed"
+			if thresholds[threshold] {
+				status = "❌ crossed"
+			}
+			rows = append(rows, fmt.Sprintf("| `%s` | `%s` | %s |\n", name, threshold, status))
+		}
+	}
+	if len(rows) > 0 {
+		b.WriteString("\n| Metric | Threshold | Result |\n|--------|-----------|--------|\n")
+		b.WriteString(strings.Join(rows, ""))
+	}
+	return b.String()
+}
+
+// deref returns the value of an optional summary value, 0 when absent
+func deref(value *float64) float64 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
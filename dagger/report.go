@@ -0,0 +1,231 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/devsecops/findings"
+	"dagger/devsecops/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// summaryReports lists the report files aggregated by the reporting job, in
+// the order they appear in summary.md
+var summaryReports = []string{
+	"secrets-report.json",
+	"gitleaks-report.json",
+	"dependency-scan.json",
+	"sast-report.json",
+	"semgrep.json",
+	"iac-report.json",
+	"polaris.json",
+	"trivy.json",
+	"zap/zap.json",
+}
+
+// summaryExcerptLines is the number of report lines quoted in summary.md
+const summaryExcerptLines = 50
+
+// securitySummary is the JSON equivalent of summary.md
+type securitySummary struct {
+	Project  string `json:"project"`
+	Commit   string `json:"commit"`
+	Branch   string `json:"branch"`
+	Pipeline string `json:"pipeline"`
+	Date     string `json:"date"`
+	Scanner  string `json:"scanner"`
+	// Reports found, in summary order
+	Reports []summaryReport `json:"reports"`
+	// Finding counts across all reports
+	Total    int                       `json:"total"`
+	Severity map[findings.Severity]int `json:"severity"`
+	// Number of reports with at least one finding
+	ReportsWithIssues int    `json:"reports_with_issues"`
+	Status            string `json:"status"`
+}
+
+// summaryReport holds the finding counts of one report
+type summaryReport struct {
+	Path     string                    `json:"path"`
+	Format   findings.Format           `json:"format"`
+	Issues   int                       `json:"issues"`
+	Severity map[findings.Severity]int `json:"severity"`
+	Tools    map[string]int            `json:"tools"`
+	excerpt  string
+}
+
+// Report builds the security summary of a reports directory (e.g. the reports
+// of a Test run) like the reporting job, and returns a directory with
+// summary.md and its JSON equivalent summary.json
+func (m *Devsecops) Report(
+	ctx context.Context,
+	// Directory containing scanner reports (gitleaks-report.json, dependency-scan.json, ...)
+	// +required
+	reports *dagger.Directory,
+	// Project path (CI_PROJECT_PATH)
+	// +optional
+	project string,
+	// Commit SHA (CI_COMMIT_SHA)
+	// +optional
+	commit string,
+	// Branch name (CI_COMMIT_REF_NAME)
+	// +optional
+	branch string,
+	// Pipeline URL (CI_PIPELINE_URL)
+	// +optional
+	pipelineUrl string,
+	// Security scanner the reports were produced with (DEVSECOPS_SECURITY_SCANNER)
+	// +default="trivy"
+	scanner string,
+	// Report date in RFC 3339 format (defaults to now)
+	// +optional
+	date string,
+) (*dagger.Directory, error) {
+	fmt.Println("📝 Generating security summary...")
+
+	summary := &securitySummary{
+		Project:  project,
+		Commit:   commit,
+		Branch:   branch,
+		Pipeline: pipelineUrl,
+		Date:     cmp.Or(date, time.Now().UTC().Format("2006-01-02T15:04:05Z")),
+		Scanner:  scanner,
+		Reports:  []summaryReport{},
+		Severity: map[findings.Severity]int{},
+	}
+
+	paths, err := summaryReportPaths(ctx, reports)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		contents, err := reports.File(path).Contents(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report %s: %w", path, err)
+		}
+
+		parsed, format, err := findings.Parse(path, []byte(contents))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("→ %s: %d issue(s)\n", path, len(parsed))
+
+		report := summaryReport{
+			Path:     path,
+			Format:   format,
+			Issues:   len(parsed),
+			Severity: findings.CountBySeverity(parsed),
+			Tools:    map[string]int{},
+			excerpt:  headLines(contents, summaryExcerptLines),
+		}
+		for _, f := range parsed {
+			report.Tools[f.Tool]++
+			summary.Severity[f.Severity]++
+		}
+		summary.Total += report.Issues
+		if report.Issues > 0 {
+			summary.ReportsWithIssues++
+		}
+		summary.Reports = append(summary.Reports, report)
+	}
+
+	summary.Status = "No critical security issues detected"
+	if summary.ReportsWithIssues > 0 {
+		summary.Status = fmt.Sprintf("%d security scan(s) found issues", summary.ReportsWithIssues)
+	}
+	fmt.Printf("📊 Status: %s\n", summary.Status)
+
+	out, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return dag.Directory().
+		WithNewFile("summary.md", summary.markdown()).
+		WithNewFile("summary.json", string(out)+"\n"), nil
+}
+
+// summaryReportPaths returns the known report files of a reports directory in
+// summary order. Monorepo reports nested under subproject paths are included
+// after the reports of the root project.
+func summaryReportPaths(ctx context.Context, reports *dagger.Directory) ([]string, error) {
+	all, err := reports.Glob(ctx, "**/*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+
+	type entry struct {
+		dir   string
+		order int
+		path  string
+	}
+	var entries []entry
+	for _, p := range all {
+		for order, name := range summaryReports {
+			if p == name || strings.HasSuffix(p, "/"+name) {
+				dir := strings.TrimSuffix(strings.TrimSuffix(p, name), "/")
+				entries = append(entries, entry{dir: dir, order: order, path: p})
+				break
+			}
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Or(
+			cmp.Compare(path.Clean("/"+a.dir), path.Clean("/"+b.dir)),
+			cmp.Compare(a.order, b.order),
+		)
+	})
+
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.path
+	}
+	return paths, nil
+}
+
+// markdown renders the summary like the reporting job's summary.md
+func (s *securitySummary) markdown() string {
+	var b strings.Builder
+	b.WriteString("# Pipeline Security Summary\n\n")
+	fmt.Fprintf(&b, "- **Project**: %s\n", s.Project)
+	fmt.Fprintf(&b, "- **Commit**: %s\n", s.Commit)
+	fmt.Fprintf(&b, "- **Branch**: %s\n", s.Branch)
+	fmt.Fprintf(&b, "- **Pipeline**: %s\n", s.Pipeline)
+	fmt.Fprintf(&b, "- **Date**: %s\n", s.Date)
+	fmt.Fprintf(&b, "- **Security Scanner**: %s\n", s.Scanner)
+	b.WriteString("\n")
+
+	for _, report := range s.Reports {
+		fmt.Fprintf(&b, "## Report: %s\n", report.Path)
+		fmt.Fprintf(&b, "- **Issues found**: %d\n", report.Issues)
+		b.WriteString("```json\n")
+		b.WriteString(report.excerpt)
+		b.WriteString("```\n\n")
+	}
+
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "Status: %s\n", s.Status)
+	return b.String()
+}
+
+// headLines returns the first n lines of s, newline-terminated like head(1)
+func headLines(s string, n int) string {
+	if s == "" {
+		return ""
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if len(lines) > n {
+		lines = lines[:n]
+	}
+	out := strings.Join(lines, "")
+	if !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	}
+	return out
+}
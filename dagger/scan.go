@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"dagger/devsecops/findings"
+	"dagger/devsecops/internal/dagger"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScanRun is the combined result of a Test run
+type ScanRun struct {
+	// Scanned path relative to the source ("." for the whole source)
+	Path string
+	// Scanned project, with its detected language and package manager
+	// (comma-separated across subprojects for a monorepo run)
+	Project *Project
+	// Individual scanner results, in execution order
+	Scans []*ScanResult
+	// Per-subproject results of a monorepo run
+	Subprojects []*ScanRun
+	// Finding counts across all scans, including subprojects
+	Summary *SeverityCounts
+	// All scanner reports, laid out like the GitLab job artifacts
+	// (under each subproject path for a monorepo run)
+	Reports *dagger.Directory
+}
+
+// ScanResult is the outcome of a single scanner
+type ScanResult struct {
+	// Scan category (secrets, dependencies, sast, iac, container)
+	Name string
+	// Tool that produced the report (gitleaks, npm-audit, pnpm-audit, pip-audit, composer-audit, semgrep, trivy, polaris)
+	Tool string
+	// passed, warning (violations under a permissive policy), failed (policy
+	// violations), skipped (nothing to scan) or error (the scanner produced no
+	// usable report)
+	Status string
+	// Exit code of the scanner command (-1 if it could not run)
+	ExitCode int
+	// Wall-clock duration of the scan (e.g. "12.4s")
+	Duration string
+	// Finding counts by severity
+	Findings *SeverityCounts
+	// Minimum severity failing the policy for this scanner ("off" when not gated)
+	Threshold string
+	// Findings violating the policy (only new findings in baseline mode)
+	Violations []string
+	// Whether findings were compared to a baseline
+	Baseline bool
+	// Findings not in the baseline
+	Added []string
+	// Baseline findings no longer reported
+	Fixed []string
+	// Number of findings also in the baseline
+	Unchanged int
+	// Number of findings suppressed by the suppression file
+	Suppressed int
+	// Findings matched only by expired suppressions, which fail the scan
+	ExpiredSuppressions []string
+	// Build time of the Trivy vulnerability DB the scan used (RFC 3339, empty
+	// for scanners without one)
+	DbUpdatedAt string
+	// Age of that DB when the scan ran (e.g. "2d4h")
+	DbAge string
+	// Last lines of the scanner stderr (or of the error that prevented the scan)
+	Stderr string
+	// Report path relative to the reports directory (e.g. "gitleaks-report.json")
+	ReportPath string
+	// Raw report written by the scanner (empty if the scanner produced none)
+	Report *dagger.File
+}
+
+// SeverityCounts holds finding counts per severity level
+type SeverityCounts struct {
+	Critical int
+	High     int
+	Medium   int
+	Low      int
+	Info     int
+	Unknown  int
+	Total    int
+}
+
+// newSeverityCounts counts parsed findings by severity
+func newSeverityCounts(parsed []findings.Finding) *SeverityCounts {
+	bySeverity := findings.CountBySeverity(parsed)
+	return &SeverityCounts{
+		Critical: bySeverity[findings.SeverityCritical],
+		High:     bySeverity[findings.SeverityHigh],
+		Medium:   bySeverity[findings.SeverityMedium],
+		Low:      bySeverity[findings.SeverityLow],
+		Info:     bySeverity[findings.SeverityInfo],
+		Unknown:  bySeverity[findings.SeverityUnknown],
+		Total:    len(parsed),
+	}
+}
+
+// add adds other counts to c
+func (c *SeverityCounts) add(other *SeverityCounts) {
+	c.Critical += other.Critical
+	c.High += other.High
+	c.Medium += other.Medium
+	c.Low += other.Low
+	c.Info += other.Info
+	c.Unknown += other.Unknown
+	c.Total += other.Total
+}
+
+// Check returns an error listing every scanner that failed the security
+// policy, to gate a pipeline on a run
+func (r *ScanRun) Check() error {
+	problems := r.problems()
+	if len(problems) > 0 {
+		return fmt.Errorf("%d security scan(s) failed:\n%s", len(problems), strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// problems describes the policy failures of the run and its subprojects
+func (r *ScanRun) problems() []string {
+	var problems []string
+	for _, scan := range r.Scans {
+		if err := scan.Check(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for _, sub := range r.Subprojects {
+		for _, problem := range sub.problems() {
+			problems = append(problems, "["+sub.Path+"] "+problem)
+		}
+	}
+	return problems
+}
+
+// maxListedViolations caps the number of findings listed in policy errors
+const maxListedViolations = 20
+
+// stderrTailLines is the number of stderr lines kept on a scan result
+const stderrTailLines = 10
+
+// Check returns an error if the scan failed the security policy or produced
+// no usable report, to gate a pipeline on a single scan
+func (r *ScanResult) Check() error {
+	var lines []string
+	switch r.Status {
+	case "error":
+		lines = append(lines, fmt.Sprintf("%s (%s) exited with code %d without a usable report",
+			r.Name, r.Tool, r.ExitCode))
+	case "failed":
+		kind := "finding(s)"
+		if r.Baseline {
+			kind = "new finding(s)"
+		}
+		if len(r.Violations) > 0 {
+			lines = append(lines, fmt.Sprintf("%s (%s, exit code %d): %d %s at or above %s",
+				r.Name, r.Tool, r.ExitCode, len(r.Violations), kind, r.Threshold))
+			lines = append(lines, listed(r.Violations)...)
+		}
+		if len(r.ExpiredSuppressions) > 0 {
+			lines = append(lines, fmt.Sprintf("%s (%s): %d finding(s) matched by expired suppressions",
+				r.Name, r.Tool, len(r.ExpiredSuppressions)))
+			lines = append(lines, listed(r.ExpiredSuppressions)...)
+		}
+	default:
+		return nil
+	}
+
+	if r.Stderr != "" {
+		lines = append(lines, "  stderr:")
+		for _, line := range strings.Split(r.Stderr, "\n") {
+			lines = append(lines, "  | "+line)
+		}
+	}
+	return fmt.Errorf("%s", strings.Join(lines, "\n"))
+}
+
+// listed formats items as a bulleted list of at most maxListedViolations lines
+func listed(items []string) []string {
+	var lines []string
+	for i, item := range items {
+		if i == maxListedViolations {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(items)-i))
+			break
+		}
+		lines = append(lines, "  - "+item)
+	}
+	return lines
+}
+
+// tail returns the last n lines of s
+func tail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// scanSpec describes a scanner invocation: the prepared container, the command
+// producing the report and where the report is written inside /src.
+type scanSpec struct {
+	name   string
+	tool   string
+	report string
+	ctr    *dagger.Container
+	cmd    []string
+	// Baseline findings of the report, when compare is set
+	baseline []findings.Finding
+	compare  bool
+	// Suppressions, and the project path their paths are relative to
+	suppressions []findings.Suppression
+	projectPath  string
+	// Metadata of the Trivy vulnerability DB the scanner matches against
+	vulnDb *dagger.File
+}
+
+// run executes the scan without failing on a non-zero exit code, collects the
+// exit code, duration, stderr, report and finding counts, and evaluates the
+// policy. Errors preventing the scan from running (e.g. a failing setup step
+// or image pull) are recorded as an "error" status.
+func (s *scanSpec) run(ctx context.Context, policy *findings.Policy) (*ScanResult, *dagger.Container) {
+	start := time.Now()
+
+	result := &ScanResult{
+		Name:       s.name,
+		Tool:       s.tool,
+		Status:     "passed",
+		Findings:   &SeverityCounts{},
+		Threshold:  "off",
+		ReportPath: s.report,
+		Report:     dag.Directory().WithNewFile(s.report, "").File(s.report),
+	}
+
+	ctr := s.ctr.WithExec(s.cmd, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny})
+	exitCode, err := ctr.ExitCode(ctx)
+	result.Duration = time.Since(start).Round(100 * time.Millisecond).String()
+	if err != nil {
+		result.Status = "error"
+		result.ExitCode = -1
+		result.Stderr = tail(err.Error(), stderrTailLines)
+
+		var execErr *dagger.ExecError
+		if errors.As(err, &execErr) {
+			result.ExitCode = execErr.ExitCode
+			result.Stderr = tail(execErr.Stderr, stderrTailLines)
+		}
+		return result, ctr
+	}
+	result.ExitCode = exitCode
+
+	if stderr, err := ctr.Stderr(ctx); err == nil {
+		result.Stderr = tail(stderr, stderrTailLines)
+	}
+
+	if s.vulnDb != nil {
+		if updatedAt, err := trivyDbUpdatedAt(ctx, s.vulnDb); err == nil {
+			result.DbUpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+			result.DbAge = dbAge(time.Since(updatedAt))
+			if time.Since(updatedAt) > staleDbAge {
+				fmt.Printf("⚠️  %s (%s): the vulnerability DB is %s old, refresh it with fetch-databases\n",
+					s.name, s.tool, result.DbAge)
+			}
+		}
+	}
+
+	report := ctr.File("/src/" + s.report)
+	contents, err := report.Contents(ctx)
+	if err != nil {
+		// The scanner did not write a report: it either crashed before scanning
+		// or had nothing to scan (e.g. a missing IaC target directory)
+		result.Status = "skipped"
+		if exitCode != 0 {
+			result.Status = "error"
+		}
+		return result, ctr
+	}
+	result.Report = report
+
+	parsed, format, err := findings.Parse(s.report, []byte(contents))
+	if err == nil && format == findings.FormatUnknown && !findings.Empty([]byte(contents)) {
+		// e.g. an empty file, an npm error object or a new tool version output
+		err = fmt.Errorf("%s report %s is in no recognized format", s.tool, s.report)
+	}
+	if err != nil {
+		// Keep the raw report available even if it cannot be parsed, but never
+		// gate on it: a report format change must not pass as zero findings
+		fmt.Printf("⚠️  %s\n", err)
+		result.Status = "error"
+		result.Stderr = tail(strings.TrimSpace(result.Stderr+"\n"+err.Error()), stderrTailLines)
+		return result, ctr
+	}
+	if len(s.suppressions) > 0 {
+		parsed, result.Suppressed, result.ExpiredSuppressions = findings.Suppress(parsed, s.suppressions, s.projectPath, time.Now())
+	}
+	result.Findings = newSeverityCounts(parsed)
+
+	if s.compare {
+		result.Baseline = true
+		parsed = result.compareBaseline(parsed, s.baseline)
+	}
+
+	if threshold, ok := policy.Threshold(s.name, s.tool); ok {
+		result.Threshold = string(threshold)
+	}
+	for _, violation := range policy.Violations(s.name, s.tool, parsed) {
+		result.Violations = append(result.Violations, violation.String())
+	}
+	if len(result.Violations) > 0 && result.Status == "passed" {
+		result.Status = "warning"
+		if policy.Strict() {
+			result.Status = "failed"
+		}
+	}
+	// Expired exceptions fail regardless of the policy
+	if len(result.ExpiredSuppressions) > 0 && result.Status != "error" {
+		result.Status = "failed"
+	}
+
+	return result, ctr
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"dagger/devsecops/findings"
+	"dagger/devsecops/internal/dagger"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// loadSuppressions reads the suppression file at the root of the source, if
+// any. Expired suppressions are listed but not applied.
+func loadSuppressions(ctx context.Context, source *dagger.Directory) ([]findings.Suppression, error) {
+	entries, err := source.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source directory: %w", err)
+	}
+	if !slices.Contains(entries, findings.SuppressionFile) {
+		return nil, nil
+	}
+
+	contents, err := source.File(findings.SuppressionFile).Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", findings.SuppressionFile, err)
+	}
+	suppressions, err := findings.ParseSuppressions([]byte(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("🙈 Loaded %d suppression(s) from %s\n", len(suppressions), findings.SuppressionFile)
+	now := time.Now()
+	for _, s := range suppressions {
+		if s.Expired(now) {
+			fmt.Printf("⚠️  Expired suppression: %s\n", s)
+		}
+	}
+	return suppressions, nil
+}
+
+// useSuppressions applies suppressions to a scan of the given project path
+func (s *scanSpec) useSuppressions(suppressions []findings.Suppression, projectPath string) {
+	s.suppressions = suppressions
+	s.projectPath = projectPath
+}
+
+// IgnoreFiles translates the .devsecops-ignore.yml suppression file of a
+// source into the native ignore files of the CI template tools: .trivyignore,
+// .gitleaksignore, .semgrepignore and semgrep-exclude-rules.txt
+func (m *Devsecops) IgnoreFiles(
+	ctx context.Context,
+	// +required
+	source *dagger.Directory,
+) (*dagger.Directory, error) {
+	suppressions, err := loadSuppressions(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if suppressions == nil {
+		return nil, fmt.Errorf("no %s found at the source root", findings.SuppressionFile)
+	}
+
+	out := dag.Directory()
+	files := findings.NativeIgnoreFiles(suppressions, time.Now())
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		out = out.WithNewFile(name, files[name])
+	}
+	return out, nil
+}
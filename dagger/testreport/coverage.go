@@ -0,0 +1,155 @@
+package testreport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Coverage is the line coverage of a coverage report
+type Coverage struct {
+	// Report format: lcov, istanbul, cobertura or clover
+	Format  string
+	Covered int
+	Total   int
+	// Line coverage percentage, rounded to two decimals
+	Percent float64
+}
+
+// ParseCoverage reads a coverage report, detected from its name and
+// contents: lcov.info (lcov), coverage-summary.json (Istanbul json-summary),
+// or a Cobertura or Clover XML report. ok is false for other files.
+func ParseCoverage(name string, data []byte) (coverage Coverage, ok bool, err error) {
+	switch {
+	case path.Ext(name) == ".info":
+		coverage, err = parseLcov(data)
+	case path.Ext(name) == ".json":
+		coverage, err = parseIstanbulSummary(data)
+	case path.Ext(name) == ".xml" && bytes.Contains(data, []byte("<coverage")):
+		coverage, err = parseCoverageXML(data)
+	default:
+		return Coverage{}, false, nil
+	}
+	if err != nil {
+		return Coverage{}, false, fmt.Errorf("invalid coverage report %s: %w", name, err)
+	}
+	return coverage, true, nil
+}
+
+// percent returns the line coverage percentage of covered out of total lines.
+// A report without lines measured nothing: its coverage is 0, not 100.
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(covered)/float64(total)*10000) / 100
+}
+
+// parseLcov sums the LF (lines found) and LH (lines hit) records of an lcov
+// tracefile
+func parseLcov(data []byte) (Coverage, error) {
+	coverage := Coverage{Format: "lcov"}
+	records := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || (key != "LF" && key != "LH") {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return Coverage{}, fmt.Errorf("invalid %s record %q", key, value)
+		}
+		records++
+		if key == "LF" {
+			coverage.Total += n
+		} else {
+			coverage.Covered += n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Coverage{}, err
+	}
+	if records == 0 {
+		return Coverage{}, fmt.Errorf("no LF/LH records")
+	}
+	coverage.Percent = percent(coverage.Covered, coverage.Total)
+	return coverage, nil
+}
+
+// parseIstanbulSummary reads the total line coverage of an Istanbul
+// json-summary report (coverage-summary.json)
+func parseIstanbulSummary(data []byte) (Coverage, error) {
+	var summary struct {
+		Total *struct {
+			Lines struct {
+				Total   int `json:"total"`
+				Covered int `json:"covered"`
+			} `json:"lines"`
+		} `json:"total"`
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return Coverage{}, err
+	}
+	if summary.Total == nil {
+		return Coverage{}, fmt.Errorf("no total")
+	}
+	lines := summary.Total.Lines
+	return Coverage{
+		Format:  "istanbul",
+		Covered: lines.Covered,
+		Total:   lines.Total,
+		Percent: percent(lines.Covered, lines.Total),
+	}, nil
+}
+
+// parseCoverageXML reads the line coverage of a Cobertura report (the
+// lines-covered and lines-valid attributes of <coverage>) or of a Clover
+// report (the project <metrics> statements)
+func parseCoverageXML(data []byte) (Coverage, error) {
+	var report struct {
+		LineRate     string `xml:"line-rate,attr"`
+		LinesCovered string `xml:"lines-covered,attr"`
+		LinesValid   string `xml:"lines-valid,attr"`
+		Project      *struct {
+			Metrics struct {
+				Statements        int `xml:"statements,attr"`
+				CoveredStatements int `xml:"coveredstatements,attr"`
+			} `xml:"metrics"`
+		} `xml:"project"`
+	}
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return Coverage{}, err
+	}
+
+	switch {
+	case report.Project != nil:
+		metrics := report.Project.Metrics
+		return Coverage{
+			Format:  "clover",
+			Covered: metrics.CoveredStatements,
+			Total:   metrics.Statements,
+			Percent: percent(metrics.CoveredStatements, metrics.Statements),
+		}, nil
+	case report.LinesValid != "":
+		covered, errCovered := strconv.Atoi(report.LinesCovered)
+		total, errTotal := strconv.Atoi(report.LinesValid)
+		if errCovered != nil || errTotal != nil {
+			return Coverage{}, fmt.Errorf("invalid lines-covered/lines-valid attributes")
+		}
+		return Coverage{Format: "cobertura", Covered: covered, Total: total, Percent: percent(covered, total)}, nil
+	case report.LineRate != "":
+		rate, err := strconv.ParseFloat(report.LineRate, 64)
+		if err != nil {
+			return Coverage{}, fmt.Errorf("invalid line-rate %q", report.LineRate)
+		}
+		return Coverage{Format: "cobertura", Percent: math.Round(rate*10000) / 100}, nil
+	}
+	return Coverage{}, fmt.Errorf("neither a Cobertura nor a Clover report")
+}
@@ -0,0 +1,90 @@
+package testreport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCoverage(t *testing.T) {
+	tests := []struct {
+		report string
+		want   Coverage
+	}{
+		{report: "lcov.info", want: Coverage{Format: "lcov", Covered: 5, Total: 7, Percent: 71.43}},
+		{report: "coverage-summary.json", want: Coverage{Format: "istanbul", Covered: 87, Total: 120, Percent: 72.5}},
+		{report: "cobertura.xml", want: Coverage{Format: "cobertura", Covered: 177, Total: 212, Percent: 83.49}},
+		{
+			// Reports without line counts only give the line rate
+			report: "cobertura-rate.xml",
+			want:   Coverage{Format: "cobertura", Percent: 91.24},
+		},
+		{report: "clover.xml", want: Coverage{Format: "clover", Covered: 15, Total: 18, Percent: 83.33}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.report, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.report))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok, err := ParseCoverage(tt.report, data)
+			if err != nil {
+				t.Fatalf("ParseCoverage() error = %v", err)
+			}
+			if !ok {
+				t.Fatal("ParseCoverage() did not recognize the report")
+			}
+			if got != tt.want {
+				t.Errorf("ParseCoverage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCoverageEdgeCases(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		want    Coverage
+		ok      bool
+		wantErr string
+	}{
+		{
+			// A report without lines measured nothing
+			name: "no lines",
+			file: "lcov.info",
+			data: "SF:src/empty.js\nLF:0\nLH:0\nend_of_record\n",
+			want: Coverage{Format: "lcov"},
+			ok:   true,
+		},
+		{name: "JUnit report", file: "junit.xml", data: `<testsuite name="pytest"/>`},
+		{name: "other file", file: "coverage.html", data: "<html></html>"},
+		{name: "lcov without records", file: "lcov.info", data: "TN:\nend_of_record\n", wantErr: "no LF/LH records"},
+		{name: "invalid lcov record", file: "lcov.info", data: "LF:many\n", wantErr: `invalid LF record "many"`},
+		{name: "json without total", file: "coverage-final.json", data: `{"/src/app.js": {}}`, wantErr: "no total"},
+		{name: "invalid line counts", file: "coverage.xml", data: `<coverage lines-valid="212" lines-covered="n/a"/>`, wantErr: "invalid lines-covered/lines-valid"},
+		{name: "unknown coverage XML", file: "coverage.xml", data: `<coverage/>`, wantErr: "neither a Cobertura nor a Clover report"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := ParseCoverage(tt.file, []byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), tt.file) {
+					t.Fatalf("ParseCoverage() error = %v, want %q for %s", err, tt.wantErr, tt.file)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCoverage() error = %v", err)
+			}
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ParseCoverage() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Package testreport reads the test and coverage reports of test runners:
+// JUnit XML, and lcov, Istanbul JSON summary, Cobertura and Clover coverage.
+package testreport
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Summary counts the test cases of JUnit reports
+type Summary struct {
+	Tests   int
+	Passed  int
+	Failed  int
+	Skipped int
+	// Failing test cases, as "suite > name"
+	FailedTests []string
+}
+
+// Add adds the test cases of another summary to s
+func (s *Summary) Add(other Summary) {
+	s.Tests += other.Tests
+	s.Passed += other.Passed
+	s.Failed += other.Failed
+	s.Skipped += other.Skipped
+	s.FailedTests = append(s.FailedTests, other.FailedTests...)
+}
+
+type junitCase struct {
+	Name      string    `xml:"name,attr"`
+	Classname string    `xml:"classname,attr"`
+	Failures  []xmlNode `xml:"failure"`
+	Errors    []xmlNode `xml:"error"`
+	Skipped   *xmlNode  `xml:"skipped"`
+}
+
+type xmlNode struct{}
+
+// ParseJUnit counts the test cases of a JUnit XML report. Test cases are
+// counted wherever they appear (<testsuites>, a single <testsuite> or nested
+// suites): an error counts as a failure.
+func ParseJUnit(data []byte) (Summary, error) {
+	var summary Summary
+	var suites []string
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Summary{}, fmt.Errorf("invalid JUnit report: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "testsuite":
+				suites = append(suites, attr(t, "name"))
+			case "testcase":
+				var c junitCase
+				if err := decoder.DecodeElement(&c, &t); err != nil {
+					return Summary{}, fmt.Errorf("invalid JUnit report: %w", err)
+				}
+				summary.Tests++
+				switch {
+				case len(c.Failures) > 0 || len(c.Errors) > 0:
+					summary.Failed++
+					summary.FailedTests = append(summary.FailedTests, caseName(c, suites))
+				case c.Skipped != nil:
+					summary.Skipped++
+				default:
+					summary.Passed++
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "testsuite" && len(suites) > 0 {
+				suites = suites[:len(suites)-1]
+			}
+		}
+	}
+
+	if summary.Tests == 0 && len(data) > 0 && !bytes.Contains(data, []byte("testsuite")) {
+		return Summary{}, fmt.Errorf("invalid JUnit report: no <testsuite> element")
+	}
+	return summary, nil
+}
+
+// caseName names a test case after its class name or innermost suite
+func caseName(c junitCase, suites []string) string {
+	group := c.Classname
+	if group == "" && len(suites) > 0 {
+		group = suites[len(suites)-1]
+	}
+	if group == "" || group == c.Name {
+		return c.Name
+	}
+	return group + " > " + c.Name
+}
+
+// attr returns the value of an attribute of an element
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package testreport
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJUnit(t *testing.T) {
+	tests := []struct {
+		report string
+		want   Summary
+	}{
+		{
+			report: "junit-jest.xml",
+			want: Summary{
+				Tests: 4, Passed: 2, Failed: 1, Skipped: 1,
+				FailedTests: []string{"app POST /login > app POST /login rejects an invalid password"},
+			},
+		},
+		{
+			// Errors count as failures
+			report: "junit-pytest.xml",
+			want: Summary{
+				Tests: 5, Passed: 2, Failed: 2, Skipped: 1,
+				FailedTests: []string{"tests.test_app > test_login", "tests.test_db > test_connect"},
+			},
+		},
+		{
+			// Test cases without a class name are named after their innermost suite
+			report: "junit-phpunit.xml",
+			want: Summary{
+				Tests: 3, Passed: 2, Failed: 1,
+				FailedTests: []string{`Tests\Unit\CartTest > testDiscount`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.report, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.report))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ParseJUnit(data)
+			if err != nil {
+				t.Fatalf("ParseJUnit() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseJUnit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJUnitEdgeCases(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Summary
+		wantErr string
+	}{
+		{name: "empty report", data: ""},
+		{name: "empty suite", data: `<testsuite name="none" tests="0"/>`},
+		{
+			name: "case named after its class",
+			data: `<testsuite><testcase classname="smoke" name="smoke"><failure/></testcase></testsuite>`,
+			want: Summary{Tests: 1, Failed: 1, FailedTests: []string{"smoke"}},
+		},
+		{name: "not a JUnit report", data: `<coverage line-rate="0.5"/>`, wantErr: "no <testsuite> element"},
+		{name: "malformed XML", data: `<testsuite><testcase name="a">`, wantErr: "invalid JUnit report"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJUnit([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseJUnit() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseJUnit() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseJUnit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummaryAdd(t *testing.T) {
+	summary := Summary{Tests: 2, Passed: 1, Failed: 1, FailedTests: []string{"a > b"}}
+	summary.Add(Summary{Tests: 3, Passed: 1, Failed: 1, Skipped: 1, FailedTests: []string{"c > d"}})
+
+	want := Summary{Tests: 5, Passed: 2, Failed: 2, Skipped: 1, FailedTests: []string{"a > b", "c > d"}}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("Add() = %+v, want %+v", summary, want)
+	}
+}
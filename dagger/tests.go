@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"dagger/devsecops/internal/dagger"
+	"dagger/devsecops/testreport"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// TestResult is the outcome of a test run
+type TestResult struct {
+	// Test runner (npm, pnpm, yarn, bun, pytest, PHPUnit)
+	Runner string
+	// passed or failed (failing tests, test command error or coverage below
+	// the minimum)
+	Status string
+	// Exit code of the test command
+	ExitCode int
+	// Test case counts from the JUnit reports (errors count as failures)
+	Tests   int
+	Passed  int
+	Failed  int
+	Skipped int
+	// Failing test cases, as "suite > name"
+	FailedTests []string
+	// Line coverage percentage (-1 without a coverage report)
+	Coverage float64
+	// Coverage report the percentage was read from (e.g. "coverage/lcov.info")
+	CoverageReport string
+	// Minimum line coverage percentage (0 when not gated)
+	MinCoverage float64
+	// Last lines of the test output
+	Output string
+	// JUnit and coverage reports at their path in the source, and the test
+	// output (test.log)
+	Reports *dagger.Directory
+}
+
+// testOutputLines is the number of test output lines kept in test errors
+const testOutputLines = 40
+
+// testReportsDir is where the reports of a test run are collected
+const testReportsDir = "/test-reports"
+
+// testReportsScript copies the JUnit and coverage reports a test run wrote
+// anywhere in the source, outside of dependency directories, to testReportsDir
+const testReportsScript = `
+mkdir -p ` + testReportsDir + `
+find . \( -name node_modules -o -name vendor -o -name .venv -o -name .git \) -prune -o -type f \( \
+  -name 'junit*.xml' -o -name 'TEST-*.xml' -o -name 'test-results.xml' -o \
+  -name lcov.info -o -name coverage-summary.json -o -name cobertura-coverage.xml -o \
+  -name clover.xml -o -name coverage.xml \
+\) -print | while read -r f; do
+  mkdir -p "` + testReportsDir + `/$(dirname "$f")" && cp "$f" "` + testReportsDir + `/$f"
+done
+`
+
+// coverageFormats lists coverage formats by preference, when a run wrote several
+var coverageFormats = []string{"istanbul", "lcov", "cobertura", "clover"}
+
+// runTests runs a test command in /src, collects its JUnit and coverage
+// reports and applies the coverage gate. The result is returned whatever the
+// outcome, so its reports can be exported when tests fail: Check gates on it.
+// Artifact directories of /src (e.g. E2E traces and screenshots) are added to
+// the reports as is, empty when the run wrote nothing to them.
+func runTests(
+	ctx context.Context,
+	container *dagger.Container,
+	runner string,
+	cmd []string,
+	minCoverage float64,
+	artifacts ...string,
+) (*TestResult, error) {
+	container = container.
+		WithEnvVariable("CI", "true").
+		WithExec(cmd, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny})
+	exitCode, err := container.ExitCode(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to run: %w", runner, err)
+	}
+	stdout, _ := container.Stdout(ctx)
+	stderr, _ := container.Stderr(ctx)
+	output := strings.TrimRight(stdout, "\n") + "\n" + stderr
+
+	reports := container.
+		WithExec([]string{"sh", "-c", testReportsScript}).
+		Directory(testReportsDir)
+
+	result := &TestResult{
+		Runner:      runner,
+		Status:      "passed",
+		ExitCode:    exitCode,
+		Coverage:    -1,
+		MinCoverage: minCoverage,
+		Output:      tail(output, testOutputLines),
+		Reports:     reports.WithNewFile("test.log", output),
+	}
+	if err := result.readReports(ctx, reports); err != nil {
+		return nil, err
+	}
+	if len(artifacts) > 0 {
+		written := container.WithExec(append([]string{"mkdir", "-p"}, artifacts...))
+		for _, dir := range artifacts {
+			result.Reports = result.Reports.WithDirectory(dir, written.Directory(path.Join("/src", dir)))
+		}
+	}
+
+	problems := result.problems()
+	fmt.Printf("🧪 %s: %d passed, %d failed, %d skipped", runner, result.Passed, result.Failed, result.Skipped)
+	if result.Coverage >= 0 {
+		fmt.Printf(", %.2f%% line coverage", result.Coverage)
+	}
+	fmt.Println()
+	if len(problems) > 0 {
+		result.Status = "failed"
+		fmt.Printf("❌ %s, see check\n", strings.Join(problems, "; "))
+	}
+	return result, nil
+}
+
+// Check returns an error with the failing tests and the end of the test
+// output when the tests failed or the coverage is below the minimum, to gate
+// a pipeline on a test run
+func (r *TestResult) Check() error {
+	problems := r.problems()
+	if len(problems) == 0 {
+		return nil
+	}
+	lines := append([]string{r.Runner + " tests failed:"}, listed(problems)...)
+	if len(r.FailedTests) > 0 {
+		lines = append(lines, "failing tests:")
+		lines = append(lines, listed(r.FailedTests)...)
+	}
+	lines = append(lines, "test output:")
+	for _, line := range strings.Split(r.Output, "\n") {
+		lines = append(lines, "  | "+line)
+	}
+	return fmt.Errorf("%s", strings.Join(lines, "\n"))
+}
+
+// readReports counts the test cases of the JUnit reports and reads the line
+// coverage of the preferred coverage report
+func (r *TestResult) readReports(ctx context.Context, reports *dagger.Directory) error {
+	var paths []string
+	for _, pattern := range []string{"**/*.xml", "**/*.info", "**/*.json"} {
+		matches, err := reports.Glob(ctx, pattern)
+		if err != nil {
+			return fmt.Errorf("failed to list test reports: %w", err)
+		}
+		paths = append(paths, matches...)
+	}
+	slices.Sort(paths)
+
+	var summary testreport.Summary
+	var coverage *testreport.Coverage
+	for _, p := range paths {
+		contents, err := reports.File(p).Contents(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read test report %s: %w", p, err)
+		}
+		data := []byte(contents)
+
+		if path.Ext(p) == ".xml" && strings.Contains(contents, "<testsuite") {
+			parsed, err := testreport.ParseJUnit(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+			summary.Add(parsed)
+			continue
+		}
+
+		parsed, ok, err := testreport.ParseCoverage(p, data)
+		if err != nil {
+			fmt.Printf("⚠️  %s\n", err)
+			continue
+		}
+		if ok && (coverage == nil ||
+			slices.Index(coverageFormats, parsed.Format) < slices.Index(coverageFormats, coverage.Format)) {
+			coverage = &parsed
+			r.CoverageReport = p
+		}
+	}
+
+	r.Tests, r.Passed, r.Failed, r.Skipped = summary.Tests, summary.Passed, summary.Failed, summary.Skipped
+	r.FailedTests = summary.FailedTests
+	if coverage != nil {
+		r.Coverage = coverage.Percent
+	}
+	return nil
+}
+
+// problems describes why a test run failed
+func (r *TestResult) problems() []string {
+	var problems []string
+	if r.Failed > 0 {
+		problems = append(problems, fmt.Sprintf("%d of %d test(s) failed", r.Failed, r.Tests))
+	}
+	if r.ExitCode != 0 {
+		problems = append(problems, fmt.Sprintf("the test command exited with code %d", r.ExitCode))
+	}
+	if r.MinCoverage > 0 {
+		switch {
+		case r.Coverage < 0:
+			problems = append(problems, fmt.Sprintf("no coverage report for the %.2f%% coverage minimum", r.MinCoverage))
+		case r.Coverage < r.MinCoverage:
+			problems = append(problems, fmt.Sprintf("line coverage %.2f%% (%s) is below the %.2f%% minimum",
+				r.Coverage, r.CoverageReport, r.MinCoverage))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"dagger/devsecops/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// trivyCacheDir is the Trivy cache directory, holding db/ and java-db/
+	trivyCacheDir = "/trivy-cache"
+	// trivyCacheVolume keeps the DB of the Trivy server across runs
+	trivyCacheVolume = "devsecops-trivy-cache"
+	// trivyServerAlias is the hostname the Trivy server is bound to
+	trivyServerAlias = "trivy-server"
+	// trivyServerPort is the port the Trivy server listens on
+	trivyServerPort = 4954
+)
+
+// trivyServer returns the Trivy server the Trivy clients run against. It
+// serves the pre-fetched DB, if any, or the DB of a cache volume, updated
+// when outdated. Every binding of the server within a session shares a single
+// instance, so the DB is initialized once per run instead of once per scan.
+func (m *Devsecops) trivyServer() (*dagger.Service, error) {
+	image, err := m.image("trivy")
+	if err != nil {
+		return nil, err
+	}
+	ctr := dag.Container().
+		From(image).
+		WithEnvVariable("TRIVY_CACHE_DIR", trivyCacheDir)
+	if m.TrivyDb != nil {
+		ctr = ctr.
+			WithMountedDirectory(trivyCacheDir, m.TrivyDb).
+			WithEnvVariable("TRIVY_SKIP_DB_UPDATE", "true")
+	} else {
+		ctr = ctr.WithMountedCache(trivyCacheDir, dag.CacheVolume(trivyCacheVolume))
+	}
+
+	return ctr.
+		WithExposedPort(trivyServerPort).
+		AsService(dagger.ContainerAsServiceOpts{
+			Args: []string{"trivy", "server", "--listen", fmt.Sprintf("0.0.0.0:%d", trivyServerPort)},
+		}), nil
+}
+
+// trivyContainer returns a Trivy container for the commands without a client
+// mode, like "trivy config" and SBOM generation. They scan Java archives and
+// misconfigurations locally: with a pre-fetched DB, they neither update the
+// Java DB and checks nor query registries for Java artifacts, so they run
+// without network access.
+func (m *Devsecops) trivyContainer() (*dagger.Container, error) {
+	image, err := m.image("trivy")
+	if err != nil {
+		return nil, err
+	}
+	ctr := dag.Container().
+		From(image).
+		WithEnvVariable("TRIVY_CACHE_DIR", trivyCacheDir)
+	if m.TrivyDb == nil {
+		return ctr, nil
+	}
+	return ctr.
+		WithMountedDirectory(trivyCacheDir, m.TrivyDb).
+		WithEnvVariable("TRIVY_SKIP_JAVA_DB_UPDATE", "true").
+		WithEnvVariable("TRIVY_SKIP_CHECK_UPDATE", "true").
+		WithEnvVariable("TRIVY_OFFLINE_SCAN", "true"), nil
+}
+
+// trivyClient returns a Trivy container running "trivy fs" and "trivy image"
+// in client mode against the Trivy server. Only the server mounts the cache
+// volume: clients keep the Java DB and checks they download in their own
+// container.
+func (m *Devsecops) trivyClient() (*dagger.Container, error) {
+	ctr, err := m.trivyContainer()
+	if err != nil {
+		return nil, err
+	}
+	server, err := m.trivyServer()
+	if err != nil {
+		return nil, err
+	}
+	return ctr.
+		WithServiceBinding(trivyServerAlias, server).
+		WithEnvVariable("TRIVY_SERVER", fmt.Sprintf("http://%s:%d", trivyServerAlias, trivyServerPort)), nil
+}
+
+// trivyDbMetadata returns the metadata of the vulnerability DB the Trivy
+// server serves
+func (m *Devsecops) trivyDbMetadata() (*dagger.File, error) {
+	if m.TrivyDb != nil {
+		return m.TrivyDb.File("db/metadata.json"), nil
+	}
+	image, err := m.image("trivy")
+	if err != nil {
+		return nil, err
+	}
+	server, err := m.trivyServer()
+	if err != nil {
+		return nil, err
+	}
+	// Ask the server for the DB it loaded rather than mounting its cache
+	// volume. Its version is not part of the exec cache key: read it as of now.
+	return dag.Container().
+		From(image).
+		WithServiceBinding(trivyServerAlias, server).
+		WithEnvVariable("DEVSECOPS_READ_AT", time.Now().UTC().Format(time.RFC3339Nano)).
+		WithExec([]string{"wget", "-qO", "/version.json", fmt.Sprintf("http://%s:%d/version", trivyServerAlias, trivyServerPort)}).
+		File("/version.json"), nil
+}
+
+// trivyDbUpdatedAt returns when the vulnerability DB of a metadata.json file,
+// or of the version of a Trivy server, was built
+func trivyDbUpdatedAt(ctx context.Context, metadata *dagger.File) (time.Time, error) {
+	contents, err := metadata.Contents(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("no Trivy vulnerability DB metadata: %w", err)
+	}
+	var parsed struct {
+		UpdatedAt time.Time
+		// Set in the version of a server
+		VulnerabilityDB *struct {
+			UpdatedAt time.Time
+		}
+	}
+	if err := json.Unmarshal([]byte(contents), &parsed); err != nil {
+		return time.Time{}, fmt.Errorf("invalid Trivy vulnerability DB metadata: %w", err)
+	}
+	if parsed.VulnerabilityDB != nil {
+		return parsed.VulnerabilityDB.UpdatedAt, nil
+	}
+	return parsed.UpdatedAt, nil
+}